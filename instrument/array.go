@@ -1,44 +1,119 @@
 package instrument
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
 type InstrumentArray struct {
-	Namespace  string
-	Subsystem  string
-	Name       string
-	counters   *Instrument
-	gauges     *Instrument
-	histograms *Instrument
+	Namespace   string
+	Subsystem   string
+	Name        string
+	counters    *Instrument
+	gauges      *Instrument
+	histograms  *Instrument
+	summaries   *Instrument
+	constLabels prometheus.Labels
+	registry    *Registry
+	err         error
 }
 
 func NewInstrumentArray(nameSpace, subSystem, name string) *InstrumentArray {
+	return DefaultRegistry.NewInstrumentArray(nameSpace, subSystem, name)
+}
+
+// NewInstrumentArray creates an InstrumentArray registering its instruments on the registry.
+func (r *Registry) NewInstrumentArray(nameSpace, subSystem, name string) *InstrumentArray {
 	ia := &InstrumentArray{
 		Namespace: nameSpace,
 		Subsystem: subSystem,
 		Name:      name,
+		registry:  r,
 	}
 	return ia
 }
 
-func (ia *InstrumentArray) AddCounter(labels []string, help string) *InstrumentArray {
-	ins, err := NewCounterMetric(ia.Namespace, ia.Subsystem, ia.Name+"_totals", help, labels)
-	if err == nil {
-		ia.counters = ins
+// Err returns the first error of adding instruments to the array, e.g. invalid labels or a
+// registration conflict. The instruments that failed are skipped by the array operations.
+func (ia *InstrumentArray) Err() error {
+	return ia.err
+}
+
+// ConstLabels sets labels with fixed values, e.g. service, version and region, on the
+// instruments added to the array afterwards.
+func (ia *InstrumentArray) ConstLabels(labels map[string]string) *InstrumentArray {
+	ia.constLabels = prometheus.Labels{}
+	for k, v := range labels {
+		ia.constLabels[k] = v
 	}
 	return ia
 }
 
-func (ia *InstrumentArray) AddGauge(labels []string, help string) *InstrumentArray {
-	ins, err := NewGaugeMetric(ia.Namespace, ia.Subsystem, ia.Name+"_metrics", help, labels)
+// add validates the labels before creating the instrument, and logs and keeps the error.
+func (ia *InstrumentArray) add(labels []string, create func() (*Instrument, error)) *Instrument {
+	err := validateLabels(labels)
+	for _, label := range labels {
+		if _, ok := ia.constLabels[label]; ok && err == nil {
+			err = fmt.Errorf("label %s is also a const label", label)
+		}
+	}
+	var ins *Instrument
 	if err == nil {
-		ia.gauges = ins
+		ins, err = create()
+	}
+	if err != nil {
+		err = fmt.Errorf("instrument array %s: %v", ia.Name, err)
+		ia.registry.logger.Error(err)
+		if ia.err == nil {
+			ia.err = err
+		}
+		return nil
+	}
+	return ins
+}
+
+func validateLabels(labels []string) error {
+	seen := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		if label == "" {
+			return fmt.Errorf("empty label name in %v", labels)
+		}
+		if seen[label] {
+			return fmt.Errorf("duplicate label name %s in %v", label, labels)
+		}
+		seen[label] = true
 	}
+	return nil
+}
+
+func (ia *InstrumentArray) AddCounter(labels []string, help string) *InstrumentArray {
+	ia.counters = ia.add(labels, func() (*Instrument, error) {
+		return ia.registry.newCounterMetric(ia.Namespace, ia.Subsystem, ia.Name+"_totals", help, labels, ia.constLabels)
+	})
+	return ia
+}
+
+func (ia *InstrumentArray) AddGauge(labels []string, help string) *InstrumentArray {
+	ia.gauges = ia.add(labels, func() (*Instrument, error) {
+		return ia.registry.newGaugeMetric(ia.Namespace, ia.Subsystem, ia.Name+"_metrics", help, labels, ia.constLabels)
+	})
 	return ia
 }
 
 func (ia *InstrumentArray) AddHistogram(labels []string, buckets []float64, help string) *InstrumentArray {
-	ins, err := NewHistogramMetric(ia.Namespace, ia.Subsystem, ia.Name+"_Observations", help, labels, buckets)
-	if err == nil {
-		ia.histograms = ins
-	}
+	ia.histograms = ia.add(labels, func() (*Instrument, error) {
+		return ia.registry.newHistogramMetric(ia.Namespace, ia.Subsystem, ia.Name+"_Observations", help, labels, buckets, ia.constLabels)
+	})
+	return ia
+}
+
+// AddSummary adds a summary with the given quantile objectives and max age, see NewSummaryMetric.
+func (ia *InstrumentArray) AddSummary(labels []string, objectives map[float64]float64, maxAge time.Duration, help string) *InstrumentArray {
+	ia.summaries = ia.add(labels, func() (*Instrument, error) {
+		return ia.registry.newSummaryMetric(ia.Namespace, ia.Subsystem, ia.Name+"_summary", help, labels, objectives, maxAge, ia.constLabels)
+	})
 	return ia
 }
 
@@ -103,6 +178,13 @@ func (ia *InstrumentArray) ObserveHistogram(value float64, lvs ...string) *Instr
 	return ia
 }
 
+func (ia *InstrumentArray) ObserveSummary(value float64, lvs ...string) *InstrumentArray {
+	if ia.summaries != nil {
+		ia.summaries.Observe(value, lvs...)
+	}
+	return ia
+}
+
 func (ia *InstrumentArray) UnRegister() {
 
 	if ia.histograms != nil {
@@ -114,5 +196,8 @@ func (ia *InstrumentArray) UnRegister() {
 	if ia.gauges != nil {
 		ia.gauges.SetUnregistered()
 	}
+	if ia.summaries != nil {
+		ia.summaries.SetUnregistered()
+	}
 
 }
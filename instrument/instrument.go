@@ -1,14 +1,25 @@
 package instrument
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/liornabat/golibs/logging"
 )
 
 type Instrument struct {
 	nameSpace string
 	subSystem string
+	name      string
+	labels    []string
 	kind      metricType
 	metric    interface{}
+	registry  *Registry
+	// registered is cleared by SetUnregistered
+	registered bool
 }
 type metricType int
 
@@ -17,100 +28,355 @@ const (
 	counterVec   metricType = 1
 	gaugeVec     metricType = 2
 	histogramVec metricType = 3
+	summaryVec   metricType = 4
 )
 
-func NewCounterMetric(nameSpace, subSystem, name, help string, labels []string) (*Instrument, error) {
-	i := &Instrument{
-		kind:      counterVec,
-		nameSpace: nameSpace,
-		subSystem: subSystem,
+func (k metricType) String() string {
+	switch k {
+	case counterVec:
+		return "counter"
+	case gaugeVec:
+		return "gauge"
+	case histogramVec:
+		return "histogram"
+	case summaryVec:
+		return "summary"
+	}
+	return "undefined"
+}
+
+// Registry creates instruments registered on a prometheus.Registerer. Registering an
+// instrument that is already registered reuses the registered collector, which is
+// unregistered once all the instruments of the Registry sharing it are unregistered.
+// Errors of instrument operations are logged instead of panicking.
+type Registry struct {
+	registerer prometheus.Registerer
+	logger     *logging.Logger
+
+	lock sync.Mutex
+	// refs counts the registered instruments of every collector
+	refs map[prometheus.Collector]int
+}
+
+// DefaultRegistry registers instruments on prometheus.DefaultRegisterer.
+var DefaultRegistry = NewRegistry(prometheus.DefaultRegisterer)
+
+// NewRegistry creates a Registry on registerer, if nil prometheus.DefaultRegisterer is used.
+func NewRegistry(registerer prometheus.Registerer) *Registry {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	return &Registry{
+		registerer: registerer,
+		logger:     logging.NewLogger("instrument"),
+		refs:       make(map[prometheus.Collector]int),
 	}
-	i.metric = prometheus.NewCounterVec(
+}
+
+// SetLogger sets the logger of the errors of instrument operations.
+func (r *Registry) SetLogger(logger *logging.Logger) *Registry {
+	r.logger = logger
+	return r
+}
+
+func NewCounterMetric(nameSpace, subSystem, name, help string, labels []string) (*Instrument, error) {
+	return DefaultRegistry.NewCounterMetric(nameSpace, subSystem, name, help, labels)
+}
+
+func NewGaugeMetric(nameSpace, subSystem, name, help string, labels []string) (*Instrument, error) {
+	return DefaultRegistry.NewGaugeMetric(nameSpace, subSystem, name, help, labels)
+}
+
+func NewHistogramMetric(nameSpace, subSystem, name, help string, labels []string, buckets []float64) (*Instrument, error) {
+	return DefaultRegistry.NewHistogramMetric(nameSpace, subSystem, name, help, labels, buckets)
+}
+
+// NewSummaryMetric creates a summary with the given quantile objectives, mapping quantiles to
+// their allowed absolute error, over a sliding window of maxAge. Zero values select the
+// Prometheus defaults.
+func NewSummaryMetric(nameSpace, subSystem, name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (*Instrument, error) {
+	return DefaultRegistry.NewSummaryMetric(nameSpace, subSystem, name, help, labels, objectives, maxAge)
+}
+
+func (r *Registry) NewCounterMetric(nameSpace, subSystem, name, help string, labels []string) (*Instrument, error) {
+	return r.newCounterMetric(nameSpace, subSystem, name, help, labels, nil)
+}
+
+func (r *Registry) NewGaugeMetric(nameSpace, subSystem, name, help string, labels []string) (*Instrument, error) {
+	return r.newGaugeMetric(nameSpace, subSystem, name, help, labels, nil)
+}
+
+func (r *Registry) NewHistogramMetric(nameSpace, subSystem, name, help string, labels []string, buckets []float64) (*Instrument, error) {
+	return r.newHistogramMetric(nameSpace, subSystem, name, help, labels, buckets, nil)
+}
+
+// NewSummaryMetric creates a summary on the registry, see NewSummaryMetric.
+func (r *Registry) NewSummaryMetric(nameSpace, subSystem, name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration) (*Instrument, error) {
+	return r.newSummaryMetric(nameSpace, subSystem, name, help, labels, objectives, maxAge, nil)
+}
+
+func (r *Registry) newCounterMetric(nameSpace, subSystem, name, help string, labels []string, constLabels prometheus.Labels) (*Instrument, error) {
+	i := r.newInstrument(counterVec, nameSpace, subSystem, name, labels)
+	if err := i.register(prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Namespace: i.nameSpace,
-			Subsystem: i.subSystem,
-			Name:      name,
-			Help:      help,
+			Namespace:   i.nameSpace,
+			Subsystem:   i.subSystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: constLabels,
 		},
-		labels)
+		labels)); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
 
-	err := prometheus.Register(i.metric.(*prometheus.CounterVec))
-	if err != nil {
+func (r *Registry) newGaugeMetric(nameSpace, subSystem, name, help string, labels []string, constLabels prometheus.Labels) (*Instrument, error) {
+	i := r.newInstrument(gaugeVec, nameSpace, subSystem, name, labels)
+	if err := i.register(prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   i.nameSpace,
+			Subsystem:   i.subSystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: constLabels,
+		},
+		labels)); err != nil {
 		return nil, err
 	}
 	return i, nil
 }
 
-func NewGaugeMetric(nameSpace, subSystem, name, help string, labels []string) (*Instrument, error) {
-	i := &Instrument{
-		kind:      gaugeVec,
-		nameSpace: nameSpace,
-		subSystem: subSystem,
+func (r *Registry) newHistogramMetric(nameSpace, subSystem, name, help string, labels []string, buckets []float64, constLabels prometheus.Labels) (*Instrument, error) {
+	i := r.newInstrument(histogramVec, nameSpace, subSystem, name, labels)
+	if err := validateHistogram(labels, constLabels, buckets); err != nil {
+		return nil, fmt.Errorf("instrument %s: %v", i.name, err)
 	}
-	i.metric = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: i.nameSpace,
-			Subsystem: i.subSystem,
-			Name:      name,
-			Help:      help,
+	if err := i.register(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   i.nameSpace,
+			Subsystem:   i.subSystem,
+			Name:        name,
+			Help:        help,
+			Buckets:     buckets,
+			ConstLabels: constLabels,
 		},
-		labels)
+		labels)); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
 
-	err := prometheus.Register(i.metric.(*prometheus.GaugeVec))
-	if err != nil {
+func (r *Registry) newSummaryMetric(nameSpace, subSystem, name, help string, labels []string, objectives map[float64]float64, maxAge time.Duration, constLabels prometheus.Labels) (*Instrument, error) {
+	i := r.newInstrument(summaryVec, nameSpace, subSystem, name, labels)
+	if err := validateSummary(labels, constLabels, objectives, maxAge); err != nil {
+		return nil, fmt.Errorf("instrument %s: %v", i.name, err)
+	}
+	if err := i.register(prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:   i.nameSpace,
+			Subsystem:   i.subSystem,
+			Name:        name,
+			Help:        help,
+			Objectives:  objectives,
+			MaxAge:      maxAge,
+			ConstLabels: constLabels,
+		},
+		labels)); err != nil {
 		return nil, err
 	}
 	return i, nil
 }
 
-func NewHistogramMetric(nameSpace, subSystem, name, help string, labels []string, buckets []float64) (*Instrument, error) {
+// validateHistogram returns the errors prometheus panics on when the histogram is observed.
+func validateHistogram(labels []string, constLabels prometheus.Labels, buckets []float64) error {
+	if err := checkReservedLabel("le", labels, constLabels); err != nil {
+		return err
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i-1] >= buckets[i] {
+			return fmt.Errorf("histogram buckets must be in increasing order: %v", buckets)
+		}
+	}
+	return nil
+}
+
+// validateSummary returns the errors prometheus panics on when the summary is observed.
+func validateSummary(labels []string, constLabels prometheus.Labels, objectives map[float64]float64, maxAge time.Duration) error {
+	if err := checkReservedLabel("quantile", labels, constLabels); err != nil {
+		return err
+	}
+	for q := range objectives {
+		if q <= 0 || q >= 1 {
+			return fmt.Errorf("summary objective %v is not between 0 and 1", q)
+		}
+	}
+	if maxAge < 0 {
+		return fmt.Errorf("negative summary max age %v", maxAge)
+	}
+	return nil
+}
 
-	i := &Instrument{
-		kind:      histogramVec,
+func checkReservedLabel(reserved string, labels []string, constLabels prometheus.Labels) error {
+	_, ok := constLabels[reserved]
+	for _, label := range labels {
+		ok = ok || label == reserved
+	}
+	if ok {
+		return fmt.Errorf("label name %s is reserved", reserved)
+	}
+	return nil
+}
+
+func (r *Registry) newInstrument(kind metricType, nameSpace, subSystem, name string, labels []string) *Instrument {
+	return &Instrument{
+		kind:      kind,
 		nameSpace: nameSpace,
 		subSystem: subSystem,
+		name:      prometheus.BuildFQName(nameSpace, subSystem, name),
+		labels:    labels,
+		registry:  r,
 	}
-	i.metric = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: i.nameSpace,
-			Subsystem: i.subSystem,
-			Name:      name,
-			Help:      help,
-			Buckets:   buckets,
-		},
-		labels)
+}
+
+// register registers the collector, or reuses the collector already registered with the same
+// name and labels.
+func (i *Instrument) register(c prometheus.Collector) error {
+	r := i.registry
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.registerer.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return fmt.Errorf("instrument %s: %v", i.name, err)
+		}
+		c = are.ExistingCollector
+	}
+	switch c.(type) {
+	case *prometheus.CounterVec:
+		if i.kind != counterVec {
+			return fmt.Errorf("instrument %s: already registered as a counter", i.name)
+		}
+	case *prometheus.GaugeVec:
+		if i.kind != gaugeVec {
+			return fmt.Errorf("instrument %s: already registered as a gauge", i.name)
+		}
+	case *prometheus.HistogramVec:
+		if i.kind != histogramVec {
+			return fmt.Errorf("instrument %s: already registered as a histogram", i.name)
+		}
+	case *prometheus.SummaryVec:
+		if i.kind != summaryVec {
+			return fmt.Errorf("instrument %s: already registered as a summary", i.name)
+		}
+	default:
+		return fmt.Errorf("instrument %s: already registered as %T", i.name, c)
+	}
+	i.metric = c
+	i.registered = true
+	r.refs[c]++
+	return nil
+}
+
+// CheckLabels returns an error if lvs does not hold a value for every label of the instrument.
+func (i *Instrument) CheckLabels(lvs ...string) error {
+	if len(lvs) != len(i.labels) {
+		return fmt.Errorf("instrument %s: expected %d label values %v, got %d %v", i.name, len(i.labels), i.labels, len(lvs), lvs)
+	}
+	return nil
+}
+
+func (i *Instrument) logError(err error) {
+	i.registry.logger.Error(err)
+}
+
+func (i *Instrument) unsupported(op string) {
+	i.logError(fmt.Errorf("instrument %s: %s is not supported by a %s", i.name, op, i.kind))
+}
 
-	err := prometheus.Register(i.metric.(*prometheus.HistogramVec))
+// counter returns the counter of the label values, or nil after logging why it is not available.
+func (i *Instrument) counter(lvs []string) prometheus.Counter {
+	cv, ok := i.metric.(*prometheus.CounterVec)
+	if !ok {
+		return nil
+	}
+	if err := i.CheckLabels(lvs...); err != nil {
+		i.logError(err)
+		return nil
+	}
+	metric, err := cv.GetMetricWithLabelValues(lvs...)
 	if err != nil {
-		return nil, err
+		i.logError(fmt.Errorf("instrument %s: %v", i.name, err))
+		return nil
 	}
-	return i, nil
+	return metric
+}
+
+func (i *Instrument) gauge(lvs []string) prometheus.Gauge {
+	gv, ok := i.metric.(*prometheus.GaugeVec)
+	if !ok {
+		return nil
+	}
+	if err := i.CheckLabels(lvs...); err != nil {
+		i.logError(err)
+		return nil
+	}
+	metric, err := gv.GetMetricWithLabelValues(lvs...)
+	if err != nil {
+		i.logError(fmt.Errorf("instrument %s: %v", i.name, err))
+		return nil
+	}
+	return metric
+}
+
+// observer returns the histogram or summary observer of the label values.
+func (i *Instrument) observer(lvs []string) prometheus.Observer {
+	ov, ok := i.metric.(interface {
+		GetMetricWithLabelValues(lvs ...string) (prometheus.Observer, error)
+	})
+	if !ok {
+		return nil
+	}
+	if err := i.CheckLabels(lvs...); err != nil {
+		i.logError(err)
+		return nil
+	}
+	metric, err := ov.GetMetricWithLabelValues(lvs...)
+	if err != nil {
+		i.logError(fmt.Errorf("instrument %s: %v", i.name, err))
+		return nil
+	}
+	return metric
 }
 
 func (i *Instrument) Add(value float64, lvs ...string) *Instrument {
 	switch i.kind {
 	case counterVec:
-		metric, err := i.metric.(*prometheus.CounterVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+		if value < 0 {
+			i.logError(fmt.Errorf("instrument %s: counter cannot decrease by %v", i.name, value))
+			return i
+		}
+		if metric := i.counter(lvs); metric != nil {
 			metric.Add(value)
 		}
 	case gaugeVec:
-		metric, err := i.metric.(*prometheus.GaugeVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+		if metric := i.gauge(lvs); metric != nil {
 			metric.Add(value)
 		}
+	default:
+		i.unsupported("Add")
 	}
 	return i
 }
 
 func (i *Instrument) Sub(value float64, lvs ...string) *Instrument {
 	switch i.kind {
-
 	case gaugeVec:
-		metric, err := i.metric.(*prometheus.GaugeVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+		if metric := i.gauge(lvs); metric != nil {
 			metric.Sub(value)
 		}
+	default:
+		i.unsupported("Sub")
 	}
 	return i
 }
@@ -118,65 +384,72 @@ func (i *Instrument) Sub(value float64, lvs ...string) *Instrument {
 func (i *Instrument) Inc(lvs ...string) *Instrument {
 	switch i.kind {
 	case counterVec:
-		metric, err := i.metric.(*prometheus.CounterVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+		if metric := i.counter(lvs); metric != nil {
 			metric.Inc()
 		}
 	case gaugeVec:
-		metric, err := i.metric.(*prometheus.GaugeVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+		if metric := i.gauge(lvs); metric != nil {
 			metric.Inc()
 		}
+	default:
+		i.unsupported("Inc")
 	}
 	return i
 }
 func (i *Instrument) Dec(lvs ...string) *Instrument {
 	switch i.kind {
-
 	case gaugeVec:
-		metric, err := i.metric.(*prometheus.GaugeVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+		if metric := i.gauge(lvs); metric != nil {
 			metric.Dec()
 		}
+	default:
+		i.unsupported("Dec")
 	}
 	return i
 }
 
 func (i *Instrument) Set(value float64, lvs ...string) *Instrument {
 	switch i.kind {
-
 	case gaugeVec:
-		metric, err := i.metric.(*prometheus.GaugeVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+		if metric := i.gauge(lvs); metric != nil {
 			metric.Set(value)
 		}
+	default:
+		i.unsupported("Set")
 	}
 	return i
 }
 
 func (i *Instrument) Observe(value float64, lvs ...string) *Instrument {
 	switch i.kind {
-
-	case histogramVec:
-		metric, err := i.metric.(*prometheus.HistogramVec).GetMetricWithLabelValues(lvs...)
-		if err == nil {
+	case histogramVec, summaryVec:
+		if metric := i.observer(lvs); metric != nil {
 			metric.Observe(value)
 		}
+	default:
+		i.unsupported("Observe")
 	}
 	return i
 }
 
+// SetUnregistered unregisters the instrument. Its collector stays registered as long as
+// other instruments of the registry share it.
 func (i *Instrument) SetUnregistered() {
-	switch i.kind {
-	case counterVec:
-		metric := i.metric.(*prometheus.CounterVec)
-		prometheus.Unregister(metric)
-	case gaugeVec:
-		metric := i.metric.(*prometheus.GaugeVec)
-		prometheus.Unregister(metric)
-	case histogramVec:
-		metric := i.metric.(*prometheus.HistogramVec)
-		prometheus.Unregister(metric)
+	c, ok := i.metric.(prometheus.Collector)
+	if !ok {
+		return
 	}
-
+	r := i.registry
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !i.registered {
+		return
+	}
+	i.registered = false
+	r.refs[c]--
+	if r.refs[c] > 0 {
+		return
+	}
+	delete(r.refs, c)
+	r.registerer.Unregister(c)
 }
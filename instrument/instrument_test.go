@@ -0,0 +1,190 @@
+package instrument
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promModel "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gather(t *testing.T, registry *prometheus.Registry) map[string]*promModel.MetricFamily {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	ret := make(map[string]*promModel.MetricFamily)
+	for _, f := range families {
+		ret[f.GetName()] = f
+	}
+	return ret
+}
+
+func TestRegistryReusesCollectors(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	r := NewRegistry(registry)
+
+	c1, err := r.NewCounterMetric("ns", "sub", "requests", "help", []string{"code"})
+	require.NoError(t, err)
+	c2, err := r.NewCounterMetric("ns", "sub", "requests", "help", []string{"code"})
+	require.NoError(t, err)
+	c1.Inc("200")
+	c2.Add(2, "200")
+
+	families := gather(t, registry)
+	assert.EqualValues(t, 3, families["ns_sub_requests"].GetMetric()[0].GetCounter().GetValue())
+
+	_, err = r.NewGaugeMetric("ns", "sub", "requests", "help", []string{"code"})
+	assert.Error(t, err)
+
+	// the shared collector is unregistered with its last instrument
+	c1.SetUnregistered()
+	c1.SetUnregistered()
+	assert.Contains(t, gather(t, registry), "ns_sub_requests")
+	c2.Inc("200")
+	assert.EqualValues(t, 4, gather(t, registry)["ns_sub_requests"].GetMetric()[0].GetCounter().GetValue())
+	c2.SetUnregistered()
+	assert.NotContains(t, gather(t, registry), "ns_sub_requests")
+}
+
+func TestInstrumentErrorsDoNotPanic(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	r := NewRegistry(registry)
+	c, err := r.NewCounterMetric("", "", "counter", "help", []string{"a", "b"})
+	require.NoError(t, err)
+	h, err := r.NewHistogramMetric("", "", "histogram", "help", nil, []float64{1})
+	require.NoError(t, err)
+
+	assert.Error(t, c.CheckLabels("x"))
+	assert.NoError(t, c.CheckLabels("x", "y"))
+	assert.NotPanics(t, func() {
+		c.Inc("only-one")
+		c.Add(-1, "x", "y")
+		c.Set(1, "x", "y")
+		h.Inc()
+		h.Observe(0.5, "extra")
+	})
+	c.Add(2, "x", "y")
+	h.Observe(0.5)
+
+	families := gather(t, registry)
+	require.Len(t, families["counter"].GetMetric(), 1)
+	assert.EqualValues(t, 2, families["counter"].GetMetric()[0].GetCounter().GetValue())
+	assert.EqualValues(t, 1, families["histogram"].GetMetric()[0].GetHistogram().GetSampleCount())
+
+	h.SetUnregistered()
+	assert.NotContains(t, gather(t, registry), "histogram")
+}
+
+func TestInstrumentArray(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	ia := NewRegistry(registry).NewInstrumentArray("ns", "sub", "calls").
+		AddCounter([]string{"func", "result"}, "calls").
+		AddGauge([]string{"func", "func"}, "in flight").
+		AddHistogram([]string{"func"}, []float64{1}, "latency")
+	require.Error(t, ia.Err())
+	assert.Contains(t, ia.Err().Error(), "duplicate label name func")
+
+	assert.NotPanics(t, func() {
+		ia.IncToCounter("get").
+			IncToCounter("get", "ok").
+			IncToGauge("get").
+			ObserveHistogram(0.5, "get", "extra").
+			ObserveHistogram(0.5, "get")
+	})
+
+	families := gather(t, registry)
+	assert.EqualValues(t, 1, families["ns_sub_calls_totals"].GetMetric()[0].GetCounter().GetValue())
+	assert.EqualValues(t, 1, families["ns_sub_calls_Observations"].GetMetric()[0].GetHistogram().GetSampleCount())
+	assert.NotContains(t, families, "ns_sub_calls_metrics")
+
+	ia.UnRegister()
+	assert.Empty(t, gather(t, registry))
+}
+
+func TestInstrumentArrayInvalidHistogram(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	r := NewRegistry(registry)
+
+	ia := r.NewInstrumentArray("", "", "reserved").AddHistogram([]string{"le"}, []float64{1}, "latency")
+	require.Error(t, ia.Err())
+	assert.Contains(t, ia.Err().Error(), "label name le is reserved")
+
+	ia = r.NewInstrumentArray("", "", "const").
+		ConstLabels(map[string]string{"le": "1"}).
+		AddHistogram([]string{"func"}, []float64{1}, "latency")
+	assert.Error(t, ia.Err())
+
+	ia = r.NewInstrumentArray("", "", "buckets").AddHistogram([]string{"func"}, []float64{1, 5, 5}, "latency")
+	require.Error(t, ia.Err())
+	assert.Contains(t, ia.Err().Error(), "increasing order")
+
+	assert.NotPanics(t, func() {
+		ia.ObserveHistogram(0.5, "get")
+	})
+	assert.Empty(t, gather(t, registry))
+}
+
+func TestSummary(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	s, err := NewRegistry(registry).NewSummaryMetric("", "", "latency", "help", []string{"func"},
+		map[float64]float64{0.5: 0.05, 0.99: 0.001}, time.Minute)
+	require.NoError(t, err)
+	for i := 1; i <= 100; i++ {
+		s.Observe(float64(i), "get")
+	}
+
+	summary := gather(t, registry)["latency"].GetMetric()[0].GetSummary()
+	assert.EqualValues(t, 100, summary.GetSampleCount())
+	assert.EqualValues(t, 5050, summary.GetSampleSum())
+	require.Len(t, summary.GetQuantile(), 2)
+	assert.InDelta(t, 50, summary.GetQuantile()[0].GetValue(), 5)
+	assert.InDelta(t, 99, summary.GetQuantile()[1].GetValue(), 1)
+}
+
+func TestInstrumentArrayConstLabels(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	ia := NewRegistry(registry).NewInstrumentArray("", "", "calls").
+		ConstLabels(map[string]string{"service": "orders", "version": "1.2"}).
+		AddCounter([]string{"func"}, "calls").
+		AddSummary([]string{"func"}, map[float64]float64{0.5: 0.05}, 0, "latency")
+	require.NoError(t, ia.Err())
+	ia.IncToCounter("get").ObserveSummary(0.5, "get").ObserveSummary(0.5)
+
+	families := gather(t, registry)
+	for _, name := range []string{"calls_totals", "calls_summary"} {
+		require.Contains(t, families, name)
+		labels := make(map[string]string)
+		for _, l := range families[name].GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		assert.Equal(t, map[string]string{"func": "get", "service": "orders", "version": "1.2"}, labels)
+	}
+	assert.EqualValues(t, 1, families["calls_summary"].GetMetric()[0].GetSummary().GetSampleCount())
+
+	ia.AddGauge([]string{"service"}, "conflict")
+	assert.Contains(t, ia.Err().Error(), "label service is also a const label")
+}
+
+func TestInstrumentArrayInvalidSummary(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	r := NewRegistry(registry)
+
+	var ia *InstrumentArray
+	require.NotPanics(t, func() {
+		ia = r.NewInstrumentArray("", "", "reserved").AddSummary([]string{"quantile"}, nil, 0, "latency")
+	})
+	require.Error(t, ia.Err())
+	assert.Contains(t, ia.Err().Error(), "label name quantile is reserved")
+
+	for _, objective := range []float64{0, 1, 1.5, -0.5} {
+		ia = r.NewInstrumentArray("", "", "objectives").AddSummary([]string{"func"}, map[float64]float64{objective: 0.01}, 0, "latency")
+		require.Error(t, ia.Err(), "objective %v", objective)
+		assert.Contains(t, ia.Err().Error(), "is not between 0 and 1")
+	}
+
+	assert.NotPanics(t, func() {
+		ia.ObserveSummary(0.5, "get")
+	})
+	assert.Empty(t, gather(t, registry))
+}
@@ -0,0 +1,325 @@
+package list
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sortedListMaxLevel    = 32
+	sortedListProbability = 0.25
+)
+
+// SortedItem is an entry of a SortedList. Key is unique within the list.
+type SortedItem struct {
+	Key   string
+	Score float64
+	Value interface{}
+}
+
+// SortedList is a bounded concurrent collection kept in order by a user comparator,
+// backed by a skip list. When the list is full the lowest ranked item is evicted.
+type SortedList struct {
+	mux     sync.Mutex
+	head    *sortedNode
+	tail    *sortedNode
+	level   int
+	length  int
+	byKey   map[string]*sortedNode
+	compare func(a, b *SortedItem) int
+	rnd     *rand.Rand
+	size    int
+	// byScore is set when the list is ordered by ByScore, so that ranges of scores are
+	// looked up through the levels.
+	byScore bool
+}
+
+type sortedNode struct {
+	item     SortedItem
+	backward *sortedNode
+	levels   []sortedLevel
+}
+
+type sortedLevel struct {
+	forward *sortedNode
+	span    int
+}
+
+// ByScore orders items by score, higher score ranks first.
+func ByScore(a, b *SortedItem) int {
+	switch {
+	case a.Score < b.Score:
+		return -1
+	case a.Score > b.Score:
+		return 1
+	}
+	return 0
+}
+
+// NewSortedList creates a sorted list bounded to size items. The compare function returns
+// a negative number when a ranks below b, zero when they are equal and a positive number
+// when a ranks above b. Equal items are ordered by key. A nil compare falls back to ByScore.
+func NewSortedList(size int, compare func(a, b *SortedItem) int) *SortedList {
+	sl := &SortedList{
+		head:    newSortedNode(sortedListMaxLevel, SortedItem{}),
+		level:   1,
+		byKey:   make(map[string]*sortedNode),
+		compare: compare,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		size:    size,
+	}
+	if sl.size == 0 {
+		sl.size = 1000
+	}
+	if sl.compare == nil {
+		sl.compare = ByScore
+		sl.byScore = true
+	}
+	return sl
+}
+
+func newSortedNode(level int, item SortedItem) *sortedNode {
+	return &sortedNode{
+		item:   item,
+		levels: make([]sortedLevel, level),
+	}
+}
+
+// Insert adds an item or replaces the item stored under the same key. It returns the item
+// that was evicted to keep the list bounded, which may be the inserted item itself, or nil.
+func (sl *SortedList) Insert(key string, score float64, value interface{}) *SortedItem {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	if node, ok := sl.byKey[key]; ok {
+		sl.delete(node)
+	}
+	sl.insert(SortedItem{Key: key, Score: score, Value: value})
+	if sl.length > sl.size {
+		return sl.removeLowest()
+	}
+	return nil
+}
+
+func (sl *SortedList) Remove(key string) *SortedItem {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	node, ok := sl.byKey[key]
+	if !ok {
+		return nil
+	}
+	sl.delete(node)
+	item := node.item
+	return &item
+}
+
+func (sl *SortedList) RemoveLowest() *SortedItem {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	return sl.removeLowest()
+}
+
+func (sl *SortedList) Get(key string) *SortedItem {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	node, ok := sl.byKey[key]
+	if !ok {
+		return nil
+	}
+	item := node.item
+	return &item
+}
+
+// Rank returns the zero based position of key counted from the highest item, or -1 if
+// the key is not in the list.
+func (sl *SortedList) Rank(key string) int {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	node, ok := sl.byKey[key]
+	if !ok {
+		return -1
+	}
+	rank := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && sl.less(&x.levels[i].forward.item, &node.item) <= 0 {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if x == node {
+			return sl.length - rank
+		}
+	}
+	return -1
+}
+
+// GetByRank returns the item at the zero based position counted from the highest item.
+func (sl *SortedList) GetByRank(rank int) *SortedItem {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	if rank < 0 || rank >= sl.length {
+		return nil
+	}
+	target := sl.length - rank
+	traversed := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= target {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == target {
+			item := x.item
+			return &item
+		}
+	}
+	return nil
+}
+
+// TopK returns up to k items ordered from the highest. A k of zero or less returns all items.
+func (sl *SortedList) TopK(k int) (result []*SortedItem) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	for x := sl.tail; x != nil; x = x.backward {
+		item := x.item
+		result = append(result, &item)
+		if k > 0 && len(result) >= k {
+			return
+		}
+	}
+	return
+}
+
+// RangeByScore returns the items with min <= score <= max ordered from the highest. Lists
+// ordered by a custom compare function are scanned entirely.
+func (sl *SortedList) RangeByScore(min, max float64) (result []*SortedItem) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	if sl.byScore {
+		// descend to the last node with a score <= max and walk back to min
+		x := sl.head
+		for i := sl.level - 1; i >= 0; i-- {
+			for x.levels[i].forward != nil && x.levels[i].forward.item.Score <= max {
+				x = x.levels[i].forward
+			}
+		}
+		for ; x != sl.head && x != nil && x.item.Score >= min; x = x.backward {
+			item := x.item
+			result = append(result, &item)
+		}
+		return
+	}
+	for x := sl.tail; x != nil; x = x.backward {
+		if x.item.Score >= min && x.item.Score <= max {
+			item := x.item
+			result = append(result, &item)
+		}
+	}
+	return
+}
+
+func (sl *SortedList) GetListSize() int {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	return sl.length
+}
+
+func (sl *SortedList) less(a, b *SortedItem) int {
+	if c := sl.compare(a, b); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Key, b.Key)
+}
+
+func (sl *SortedList) randomLevel() int {
+	level := 1
+	for level < sortedListMaxLevel && sl.rnd.Float64() < sortedListProbability {
+		level++
+	}
+	return level
+}
+
+func (sl *SortedList) insert(item SortedItem) {
+	var update [sortedListMaxLevel]*sortedNode
+	var rank [sortedListMaxLevel]int
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && sl.less(&x.levels[i].forward.item, &item) < 0 {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+	level := sl.randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.head
+			update[i].levels[i].span = sl.length
+		}
+		sl.level = level
+	}
+	x = newSortedNode(level, item)
+	for i := 0; i < level; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < sl.level; i++ {
+		update[i].levels[i].span++
+	}
+	if update[0] != sl.head {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+	sl.byKey[item.Key] = x
+}
+
+func (sl *SortedList) delete(node *sortedNode) {
+	var update [sortedListMaxLevel]*sortedNode
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && sl.less(&x.levels[i].forward.item, &node.item) < 0 {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+	for i := 0; i < sl.level; i++ {
+		if update[i].levels[i].forward == node {
+			update[i].levels[i].span += node.levels[i].span - 1
+			update[i].levels[i].forward = node.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if node.levels[0].forward != nil {
+		node.levels[0].forward.backward = node.backward
+	} else {
+		sl.tail = node.backward
+	}
+	for sl.level > 1 && sl.head.levels[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+	delete(sl.byKey, node.item.Key)
+}
+
+func (sl *SortedList) removeLowest() *SortedItem {
+	node := sl.head.levels[0].forward
+	if node == nil {
+		return nil
+	}
+	sl.delete(node)
+	item := node.item
+	return &item
+}
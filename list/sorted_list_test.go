@@ -0,0 +1,156 @@
+package list
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func keysOf(items []*SortedItem) []string {
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+func TestSortedListInsertAndRank(t *testing.T) {
+	sl := NewSortedList(10, nil)
+	sl.Insert("a", 10, nil)
+	sl.Insert("b", 30, nil)
+	sl.Insert("c", 20, "payload")
+
+	assert.Equal(t, 3, sl.GetListSize())
+	assert.Equal(t, []string{"b", "c", "a"}, keysOf(sl.TopK(0)))
+	assert.Equal(t, 0, sl.Rank("b"))
+	assert.Equal(t, 1, sl.Rank("c"))
+	assert.Equal(t, 2, sl.Rank("a"))
+	assert.Equal(t, -1, sl.Rank("missing"))
+	assert.Equal(t, "payload", sl.Get("c").Value)
+	assert.Equal(t, "a", sl.GetByRank(2).Key)
+	assert.Nil(t, sl.GetByRank(3))
+}
+
+func TestSortedListDedupeByKey(t *testing.T) {
+	sl := NewSortedList(10, nil)
+	sl.Insert("a", 10, nil)
+	sl.Insert("b", 20, nil)
+	sl.Insert("a", 30, nil)
+
+	assert.Equal(t, 2, sl.GetListSize())
+	assert.Equal(t, []string{"a", "b"}, keysOf(sl.TopK(0)))
+	assert.EqualValues(t, 30, sl.Get("a").Score)
+}
+
+func TestSortedListEvictsLowest(t *testing.T) {
+	sl := NewSortedList(2, nil)
+	assert.Nil(t, sl.Insert("a", 10, nil))
+	assert.Nil(t, sl.Insert("b", 20, nil))
+
+	evicted := sl.Insert("c", 30, nil)
+	require.NotNil(t, evicted)
+	assert.Equal(t, "a", evicted.Key)
+
+	evicted = sl.Insert("d", 5, nil)
+	require.NotNil(t, evicted)
+	assert.Equal(t, "d", evicted.Key)
+	assert.Equal(t, []string{"c", "b"}, keysOf(sl.TopK(0)))
+}
+
+func TestSortedListRangeAndTopK(t *testing.T) {
+	sl := NewSortedList(0, nil)
+	for i := 0; i < 10; i++ {
+		sl.Insert(fmt.Sprintf("k%d", i), float64(i), nil)
+	}
+	assert.Equal(t, []string{"k9", "k8", "k7"}, keysOf(sl.TopK(3)))
+	assert.Equal(t, []string{"k5", "k4", "k3"}, keysOf(sl.RangeByScore(3, 5)))
+	assert.Empty(t, sl.RangeByScore(20, 30))
+
+	assert.Equal(t, "k0", sl.RemoveLowest().Key)
+	assert.Equal(t, "k4", sl.Remove("k4").Key)
+	assert.Nil(t, sl.Remove("k4"))
+	assert.Equal(t, 8, sl.GetListSize())
+	assert.Equal(t, 5, sl.Rank("k3"))
+}
+
+func TestSortedListCustomComparator(t *testing.T) {
+	// lower score ranks first, e.g. race times
+	sl := NewSortedList(10, func(a, b *SortedItem) int {
+		return ByScore(b, a)
+	})
+	sl.Insert("slow", 30, nil)
+	sl.Insert("fast", 10, nil)
+	sl.Insert("tie-b", 20, nil)
+	sl.Insert("tie-a", 20, nil)
+
+	assert.Equal(t, []string{"fast", "tie-b", "tie-a", "slow"}, keysOf(sl.TopK(0)))
+}
+
+func TestSortedListMatchesSort(t *testing.T) {
+	sl := NewSortedList(100, nil)
+	scores := make(map[string]float64)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("k%d", rnd.Intn(150))
+		score := float64(rnd.Intn(50))
+		scores[key] = score
+		if evicted := sl.Insert(key, score, nil); evicted != nil {
+			delete(scores, evicted.Key)
+		}
+		if len(scores) > 100 {
+			t.Fatalf("list size exceeded: %d", len(scores))
+		}
+	}
+
+	expected := make([]string, 0, len(scores))
+	for k := range scores {
+		expected = append(expected, k)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if scores[expected[i]] != scores[expected[j]] {
+			return scores[expected[i]] > scores[expected[j]]
+		}
+		return expected[i] > expected[j]
+	})
+	require.Equal(t, expected, keysOf(sl.TopK(0)))
+	for i, k := range expected {
+		assert.Equal(t, i, sl.Rank(k))
+		assert.Equal(t, k, sl.GetByRank(i).Key)
+	}
+}
+
+func TestSortedListConcurrent(t *testing.T) {
+	sl := NewSortedList(50, nil)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				sl.Insert(fmt.Sprintf("%d-%d", g, i), float64(i), nil)
+				sl.TopK(5)
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 50, sl.GetListSize())
+}
+
+func TestSortedListRangeByScoreLevels(t *testing.T) {
+	byScore := NewSortedList(0, nil)
+	custom := NewSortedList(0, func(a, b *SortedItem) int { return ByScore(a, b) })
+	for i := 0; i < 500; i++ {
+		score := float64(rand.Intn(100))
+		byScore.Insert(fmt.Sprintf("k%d", i), score, nil)
+		custom.Insert(fmt.Sprintf("k%d", i), score, nil)
+	}
+	for _, r := range [][2]float64{{0, 99}, {10, 20}, {-5, 0}, {50, 50}, {99, 200}, {30, 10}} {
+		assert.Equal(t, keysOf(custom.RangeByScore(r[0], r[1])), keysOf(byScore.RangeByScore(r[0], r[1])), "range %v", r)
+	}
+	assert.Len(t, byScore.RangeByScore(0, 99), 500)
+}
@@ -0,0 +1,395 @@
+package metrics
+
+import (
+	"context"
+	"path"
+	"time"
+)
+
+// NewTeeFactory returns a Factory that forwards every metric to all the given factories,
+// e.g. to emit the same metrics to Prometheus and StatsD during a migration.
+func NewTeeFactory(factories ...Factory) Factory {
+	return &teeFactory{factories: factories}
+}
+
+type teeFactory struct {
+	factories []Factory
+}
+
+func (t *teeFactory) Counter(name string, tags map[string]string) Counter {
+	counters := make(teeCounter, 0, len(t.factories))
+	for _, f := range t.factories {
+		counters = append(counters, f.Counter(name, tags))
+	}
+	return counters
+}
+
+func (t *teeFactory) Timer(name string, tags map[string]string) Timer {
+	timers := make(teeTimer, 0, len(t.factories))
+	for _, f := range t.factories {
+		timers = append(timers, f.Timer(name, tags))
+	}
+	return timers
+}
+
+func (t *teeFactory) Gauge(name string, tags map[string]string) Gauge {
+	gauges := make(teeGauge, 0, len(t.factories))
+	for _, f := range t.factories {
+		gauges = append(gauges, f.Gauge(name, tags))
+	}
+	return gauges
+}
+
+func (t *teeFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	histograms := make(teeHistogram, 0, len(t.factories))
+	for _, f := range t.factories {
+		histograms = append(histograms, f.Histogram(name, tags, buckets))
+	}
+	return histograms
+}
+
+// CounterWithOptions implements CounterWithOptions of OptionsFactory.
+func (t *teeFactory) CounterWithOptions(opts MetricOptions) Counter {
+	counters := make(teeCounter, 0, len(t.factories))
+	for _, f := range t.factories {
+		counters = append(counters, counterWithOptions(f, opts))
+	}
+	return counters
+}
+
+// TimerWithOptions implements TimerWithOptions of OptionsFactory.
+func (t *teeFactory) TimerWithOptions(opts MetricOptions) Timer {
+	timers := make(teeTimer, 0, len(t.factories))
+	for _, f := range t.factories {
+		timers = append(timers, timerWithOptions(f, opts))
+	}
+	return timers
+}
+
+// GaugeWithOptions implements GaugeWithOptions of OptionsFactory.
+func (t *teeFactory) GaugeWithOptions(opts MetricOptions) Gauge {
+	gauges := make(teeGauge, 0, len(t.factories))
+	for _, f := range t.factories {
+		gauges = append(gauges, gaugeWithOptions(f, opts))
+	}
+	return gauges
+}
+
+// HistogramWithOptions implements HistogramWithOptions of OptionsFactory.
+func (t *teeFactory) HistogramWithOptions(opts MetricOptions) Histogram {
+	histograms := make(teeHistogram, 0, len(t.factories))
+	for _, f := range t.factories {
+		histograms = append(histograms, histogramWithOptions(f, opts))
+	}
+	return histograms
+}
+
+func (t *teeFactory) Namespace(name string, tags map[string]string) Factory {
+	factories := make([]Factory, 0, len(t.factories))
+	for _, f := range t.factories {
+		factories = append(factories, f.Namespace(name, tags))
+	}
+	return &teeFactory{factories: factories}
+}
+
+type teeCounter []Counter
+
+func (t teeCounter) Inc(delta int64) {
+	for _, c := range t {
+		c.Inc(delta)
+	}
+}
+
+type teeTimer []Timer
+
+func (t teeTimer) Record(d time.Duration) {
+	for _, timer := range t {
+		timer.Record(d)
+	}
+}
+
+func (t teeTimer) RecordContext(ctx context.Context, d time.Duration) {
+	for _, timer := range t {
+		RecordTimer(ctx, timer, d)
+	}
+}
+
+type teeGauge []Gauge
+
+func (t teeGauge) Update(value int64) {
+	for _, g := range t {
+		g.Update(value)
+	}
+}
+
+type teeHistogram []Histogram
+
+func (t teeHistogram) Record(value float64) {
+	for _, h := range t {
+		h.Record(value)
+	}
+}
+
+func (t teeHistogram) RecordContext(ctx context.Context, value float64) {
+	for _, h := range t {
+		RecordHistogram(ctx, h, value)
+	}
+}
+
+// NewTagFilterFactory returns a Factory that passes the tags of every metric and namespace
+// through rewrite before handing them to f. The map passed to rewrite is a copy and may be
+// modified in place.
+func NewTagFilterFactory(f Factory, rewrite func(tags map[string]string) map[string]string) Factory {
+	return &tagFilterFactory{factory: f, rewrite: rewrite}
+}
+
+// DropTags returns a tag rewriter for NewTagFilterFactory that removes the given tag keys,
+// e.g. high cardinality tags that must not reach Prometheus.
+func DropTags(keys ...string) func(tags map[string]string) map[string]string {
+	return func(tags map[string]string) map[string]string {
+		for _, k := range keys {
+			delete(tags, k)
+		}
+		return tags
+	}
+}
+
+type tagFilterFactory struct {
+	factory Factory
+	rewrite func(tags map[string]string) map[string]string
+}
+
+func (t *tagFilterFactory) apply(tags map[string]string) map[string]string {
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return t.rewrite(copied)
+}
+
+func (t *tagFilterFactory) Counter(name string, tags map[string]string) Counter {
+	return t.factory.Counter(name, t.apply(tags))
+}
+
+func (t *tagFilterFactory) Timer(name string, tags map[string]string) Timer {
+	return t.factory.Timer(name, t.apply(tags))
+}
+
+func (t *tagFilterFactory) Gauge(name string, tags map[string]string) Gauge {
+	return t.factory.Gauge(name, t.apply(tags))
+}
+
+func (t *tagFilterFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	return t.factory.Histogram(name, t.apply(tags), buckets)
+}
+
+// CounterWithOptions implements CounterWithOptions of OptionsFactory.
+func (t *tagFilterFactory) CounterWithOptions(opts MetricOptions) Counter {
+	opts.Tags = t.apply(opts.Tags)
+	return counterWithOptions(t.factory, opts)
+}
+
+// TimerWithOptions implements TimerWithOptions of OptionsFactory.
+func (t *tagFilterFactory) TimerWithOptions(opts MetricOptions) Timer {
+	opts.Tags = t.apply(opts.Tags)
+	return timerWithOptions(t.factory, opts)
+}
+
+// GaugeWithOptions implements GaugeWithOptions of OptionsFactory.
+func (t *tagFilterFactory) GaugeWithOptions(opts MetricOptions) Gauge {
+	opts.Tags = t.apply(opts.Tags)
+	return gaugeWithOptions(t.factory, opts)
+}
+
+// HistogramWithOptions implements HistogramWithOptions of OptionsFactory.
+func (t *tagFilterFactory) HistogramWithOptions(opts MetricOptions) Histogram {
+	opts.Tags = t.apply(opts.Tags)
+	return histogramWithOptions(t.factory, opts)
+}
+
+func (t *tagFilterFactory) Namespace(name string, tags map[string]string) Factory {
+	return &tagFilterFactory{factory: t.factory.Namespace(name, t.apply(tags)), rewrite: t.rewrite}
+}
+
+// NewPrefixFactory returns a Factory that prefixes the top level names, so every metric
+// gets the prefix exactly once no matter how deeply namespaces are nested.
+func NewPrefixFactory(f Factory, prefix string) Factory {
+	return &renameFactory{
+		factory: f,
+		rename:  func(name string) string { return prefix + name },
+		once:    true,
+	}
+}
+
+// NewRenameFactory returns a Factory that maps the name of every metric and every
+// namespace through rename before handing it to f.
+func NewRenameFactory(f Factory, rename func(name string) string) Factory {
+	return &renameFactory{factory: f, rename: rename}
+}
+
+type renameFactory struct {
+	factory Factory
+	rename  func(name string) string
+	// once applies rename to the top level only.
+	once bool
+}
+
+func (r *renameFactory) Counter(name string, tags map[string]string) Counter {
+	return r.factory.Counter(r.rename(name), tags)
+}
+
+func (r *renameFactory) Timer(name string, tags map[string]string) Timer {
+	return r.factory.Timer(r.rename(name), tags)
+}
+
+func (r *renameFactory) Gauge(name string, tags map[string]string) Gauge {
+	return r.factory.Gauge(r.rename(name), tags)
+}
+
+func (r *renameFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	return r.factory.Histogram(r.rename(name), tags, buckets)
+}
+
+// CounterWithOptions implements CounterWithOptions of OptionsFactory.
+func (r *renameFactory) CounterWithOptions(opts MetricOptions) Counter {
+	opts.Name = r.rename(opts.Name)
+	return counterWithOptions(r.factory, opts)
+}
+
+// TimerWithOptions implements TimerWithOptions of OptionsFactory.
+func (r *renameFactory) TimerWithOptions(opts MetricOptions) Timer {
+	opts.Name = r.rename(opts.Name)
+	return timerWithOptions(r.factory, opts)
+}
+
+// GaugeWithOptions implements GaugeWithOptions of OptionsFactory.
+func (r *renameFactory) GaugeWithOptions(opts MetricOptions) Gauge {
+	opts.Name = r.rename(opts.Name)
+	return gaugeWithOptions(r.factory, opts)
+}
+
+// HistogramWithOptions implements HistogramWithOptions of OptionsFactory.
+func (r *renameFactory) HistogramWithOptions(opts MetricOptions) Histogram {
+	opts.Name = r.rename(opts.Name)
+	return histogramWithOptions(r.factory, opts)
+}
+
+func (r *renameFactory) Namespace(name string, tags map[string]string) Factory {
+	ns := r.factory.Namespace(r.rename(name), tags)
+	if r.once {
+		return ns
+	}
+	return &renameFactory{factory: ns, rename: r.rename}
+}
+
+// NewNameFilterFactory returns a Factory that only creates the metrics allowed by name,
+// the others are replaced by null metrics. Names are matched against the full name,
+// enclosing namespaces joined with ".", using path.Match patterns such as "http.*".
+// An empty allow list allows every metric that does not match the deny list.
+func NewNameFilterFactory(f Factory, allow []string, deny []string) Factory {
+	return &nameFilterFactory{factory: f, allow: allow, deny: deny}
+}
+
+type nameFilterFactory struct {
+	factory Factory
+	scope   string
+	allow   []string
+	deny    []string
+}
+
+func (n *nameFilterFactory) fullName(name string) string {
+	if n.scope == "" {
+		return name
+	}
+	if name == "" {
+		return n.scope
+	}
+	return n.scope + "." + name
+}
+
+func (n *nameFilterFactory) allowed(name string) bool {
+	name = n.fullName(name)
+	for _, pattern := range n.deny {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(n.allow) == 0 {
+		return true
+	}
+	for _, pattern := range n.allow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *nameFilterFactory) Counter(name string, tags map[string]string) Counter {
+	if !n.allowed(name) {
+		return NullCounter
+	}
+	return n.factory.Counter(name, tags)
+}
+
+func (n *nameFilterFactory) Timer(name string, tags map[string]string) Timer {
+	if !n.allowed(name) {
+		return NullTimer
+	}
+	return n.factory.Timer(name, tags)
+}
+
+func (n *nameFilterFactory) Gauge(name string, tags map[string]string) Gauge {
+	if !n.allowed(name) {
+		return NullGauge
+	}
+	return n.factory.Gauge(name, tags)
+}
+
+func (n *nameFilterFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	if !n.allowed(name) {
+		return NullHistogram
+	}
+	return n.factory.Histogram(name, tags, buckets)
+}
+
+// CounterWithOptions implements CounterWithOptions of OptionsFactory.
+func (n *nameFilterFactory) CounterWithOptions(opts MetricOptions) Counter {
+	if !n.allowed(opts.Name) {
+		return NullCounter
+	}
+	return counterWithOptions(n.factory, opts)
+}
+
+// TimerWithOptions implements TimerWithOptions of OptionsFactory.
+func (n *nameFilterFactory) TimerWithOptions(opts MetricOptions) Timer {
+	if !n.allowed(opts.Name) {
+		return NullTimer
+	}
+	return timerWithOptions(n.factory, opts)
+}
+
+// GaugeWithOptions implements GaugeWithOptions of OptionsFactory.
+func (n *nameFilterFactory) GaugeWithOptions(opts MetricOptions) Gauge {
+	if !n.allowed(opts.Name) {
+		return NullGauge
+	}
+	return gaugeWithOptions(n.factory, opts)
+}
+
+// HistogramWithOptions implements HistogramWithOptions of OptionsFactory.
+func (n *nameFilterFactory) HistogramWithOptions(opts MetricOptions) Histogram {
+	if !n.allowed(opts.Name) {
+		return NullHistogram
+	}
+	return histogramWithOptions(n.factory, opts)
+}
+
+func (n *nameFilterFactory) Namespace(name string, tags map[string]string) Factory {
+	return &nameFilterFactory{
+		factory: n.factory.Namespace(name, tags),
+		scope:   n.fullName(name),
+		allow:   n.allow,
+		deny:    n.deny,
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeeFactory(t *testing.T) {
+	f1 := NewLocalFactory(0)
+	defer f1.Stop()
+	f2 := NewLocalFactory(0)
+	defer f2.Stop()
+
+	tee := NewTeeFactory(f1, f2).Namespace("ns", map[string]string{"a": "b"})
+	tee.Counter("counter", nil).Inc(2)
+	tee.Gauge("gauge", nil).Update(3)
+	tee.Timer("timer", nil).Record(time.Millisecond)
+	tee.Histogram("histogram", nil, []float64{1}).Record(1)
+
+	for _, f := range []*LocalFactory{f1, f2} {
+		c, g := f.Snapshot()
+		assert.EqualValues(t, 2, c["ns.counter|a=b"])
+		assert.EqualValues(t, 1, c["ns.histogram|a=b.1"])
+		assert.EqualValues(t, 3, g["ns.gauge|a=b"])
+		assert.EqualValues(t, 1, g["ns.timer|a=b.P50"])
+	}
+}
+
+func TestTagFilterFactory(t *testing.T) {
+	local := NewLocalFactory(0)
+	defer local.Stop()
+
+	f := NewTagFilterFactory(local, DropTags("user_id"))
+	tags := map[string]string{"user_id": "42", "x": "y"}
+	f.Namespace("ns", map[string]string{"user_id": "7"}).Counter("counter", tags).Inc(1)
+	f.Gauge("gauge", tags).Update(1)
+
+	c, g := local.Snapshot()
+	assert.Equal(t, map[string]int64{"ns.counter|x=y": 1}, c)
+	assert.Equal(t, map[string]int64{"gauge|x=y": 1}, g)
+	assert.Equal(t, "42", tags["user_id"], "caller tags must not be modified")
+}
+
+func TestPrefixAndRenameFactory(t *testing.T) {
+	local := NewLocalFactory(0)
+	defer local.Stop()
+
+	prefixed := NewPrefixFactory(local, "svc_")
+	prefixed.Counter("top", nil).Inc(1)
+	prefixed.Namespace("http", nil).Namespace("server", nil).Counter("requests", nil).Inc(1)
+
+	renamed := NewRenameFactory(local, strings.ToUpper)
+	renamed.Namespace("db", nil).Counter("queries", nil).Inc(1)
+
+	c, _ := local.Snapshot()
+	assert.Equal(t, map[string]int64{
+		"svc_top":                  1,
+		"svc_http.server.requests": 1,
+		"DB.QUERIES":               1,
+	}, c)
+}
+
+func TestNameFilterFactory(t *testing.T) {
+	local := NewLocalFactory(0)
+	defer local.Stop()
+
+	f := NewNameFilterFactory(local, []string{"http.*", "db.*"}, []string{"http.debug*"})
+	http := f.Namespace("http", nil)
+	http.Counter("requests", nil).Inc(1)
+	http.Counter("debug_requests", nil).Inc(1)
+	http.Timer("latency", nil).Record(time.Millisecond)
+	f.Namespace("db", nil).Gauge("connections", nil).Update(5)
+	f.Counter("other", nil).Inc(1)
+	f.Histogram("size", nil, nil).Record(1)
+
+	c, g := local.Snapshot()
+	assert.Equal(t, map[string]int64{"http.requests": 1}, c)
+	assert.EqualValues(t, 5, g["db.connections"])
+	assert.Contains(t, g, "http.latency.P50")
+	assert.Len(t, g, 7)
+}
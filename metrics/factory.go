@@ -23,12 +23,67 @@ type Factory interface {
 	Counter(name string, tags map[string]string) Counter
 	Timer(name string, tags map[string]string) Timer
 	Gauge(name string, tags map[string]string) Gauge
+	// Histogram returns a histogram with the given buckets, nil buckets selects the factory default.
+	Histogram(name string, tags map[string]string, buckets []float64) Histogram
 
 	// Namespace returns a nested metrics factory.
 	Namespace(name string, tags map[string]string) Factory
 }
 
-// NullFactory is a metrics factory that returns NullCounter, NullTimer, and NullGauge.
+// MetricOptions describes a metric beyond its name and tags.
+type MetricOptions struct {
+	Name string
+	Tags map[string]string
+	// Help describes the metric, e.g. the HELP text of Prometheus. Empty selects the name.
+	Help string
+	// Buckets of histograms and timers, timer buckets are in seconds. Nil selects the factory default.
+	Buckets []float64
+}
+
+// OptionsFactory is implemented by factories that can use all of MetricOptions.
+// Init uses it for the `help` and `buckets` tags, other factories ignore them.
+type OptionsFactory interface {
+	Factory
+
+	CounterWithOptions(opts MetricOptions) Counter
+	TimerWithOptions(opts MetricOptions) Timer
+	GaugeWithOptions(opts MetricOptions) Gauge
+	HistogramWithOptions(opts MetricOptions) Histogram
+}
+
+// counterWithOptions creates a counter with all of opts if f is an OptionsFactory.
+func counterWithOptions(f Factory, opts MetricOptions) Counter {
+	if of, ok := f.(OptionsFactory); ok {
+		return of.CounterWithOptions(opts)
+	}
+	return f.Counter(opts.Name, opts.Tags)
+}
+
+// timerWithOptions creates a timer with all of opts if f is an OptionsFactory.
+func timerWithOptions(f Factory, opts MetricOptions) Timer {
+	if of, ok := f.(OptionsFactory); ok {
+		return of.TimerWithOptions(opts)
+	}
+	return f.Timer(opts.Name, opts.Tags)
+}
+
+// gaugeWithOptions creates a gauge with all of opts if f is an OptionsFactory.
+func gaugeWithOptions(f Factory, opts MetricOptions) Gauge {
+	if of, ok := f.(OptionsFactory); ok {
+		return of.GaugeWithOptions(opts)
+	}
+	return f.Gauge(opts.Name, opts.Tags)
+}
+
+// histogramWithOptions creates a histogram with all of opts if f is an OptionsFactory.
+func histogramWithOptions(f Factory, opts MetricOptions) Histogram {
+	if of, ok := f.(OptionsFactory); ok {
+		return of.HistogramWithOptions(opts)
+	}
+	return f.Histogram(opts.Name, opts.Tags, opts.Buckets)
+}
+
+// NullFactory is a metrics factory that returns NullCounter, NullTimer, NullGauge, and NullHistogram.
 var NullFactory Factory = nullFactory{}
 
 type nullFactory struct{}
@@ -37,6 +92,9 @@ func (nullFactory) Counter(name string, tags map[string]string) Counter   { retu
 func (nullFactory) Timer(name string, tags map[string]string) Timer       { return NullTimer }
 func (nullFactory) Gauge(name string, tags map[string]string) Gauge       { return NullGauge }
 func (nullFactory) Namespace(name string, tags map[string]string) Factory { return NullFactory }
+func (nullFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	return NullHistogram
+}
 
 type MetricsFactory struct {
 	metricsCache *cache.LRU
@@ -73,6 +131,12 @@ func (mf *MetricsFactory) AddTimer(key, name string, tags map[string]string) *Ti
 	return &t
 }
 
+func (mf *MetricsFactory) AddHistogram(key, name string, tags map[string]string, buckets []float64) *Histogram {
+	h := mf.promFactory.Histogram(name, tags, buckets)
+	mf.metricsCache.Put(key, &h)
+	return &h
+}
+
 func (mf *MetricsFactory) GetCounter(key string) *Counter {
 	v, ok := mf.metricsCache.Get(key).(*Counter)
 	if ok {
@@ -96,3 +160,11 @@ func (mf *MetricsFactory) GetTimer(key string) *Timer {
 	}
 	return nil
 }
+
+func (mf *MetricsFactory) GetHistogram(key string) *Histogram {
+	v, ok := mf.metricsCache.Get(key).(*Histogram)
+	if ok {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import "context"
+
+// Histogram that keeps track of a distribution of values, e.g. payload or batch sizes.
+type Histogram interface {
+	// Records the value passed in.
+	Record(float64)
+}
+
+// ContextHistogram is implemented by histograms that use the context of a recording, e.g. to
+// attach the trace ID of the active span as an exemplar.
+type ContextHistogram interface {
+	RecordContext(ctx context.Context, v float64)
+}
+
+// RecordHistogram records v to h, passing ctx along if h is a ContextHistogram.
+func RecordHistogram(ctx context.Context, h Histogram, v float64) {
+	if ch, ok := h.(ContextHistogram); ok {
+		ch.RecordContext(ctx, v)
+		return
+	}
+	h.Record(v)
+}
+
+// NullHistogram histogram that does nothing
+var NullHistogram Histogram = nullHistogram{}
+
+type nullHistogram struct{}
+
+func (nullHistogram) Record(float64) {}
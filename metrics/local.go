@@ -16,6 +16,7 @@ package metrics
 
 import (
 	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,28 +31,41 @@ import (
 // A LocalBackend is a metrics provider which aggregates data in-vm, and
 // allows exporting snapshots to shove the data into a remote collector
 type LocalBackend struct {
-	cm       sync.Mutex
-	gm       sync.Mutex
-	tm       sync.Mutex
-	counters map[string]*int64
-	gauges   map[string]*int64
-	timers   map[string]*localBackendTimer
-	stop     chan struct{}
-	wg       sync.WaitGroup
-	TagsSep  string
-	TagKVSep string
+	cm         sync.Mutex
+	gm         sync.Mutex
+	tm         sync.Mutex
+	hm         sync.Mutex
+	sm         sync.Mutex
+	series     map[string]localSeries
+	counters   map[string]*int64
+	rates      map[string]*localCounterRates
+	gauges     map[string]*int64
+	timers     map[string]*localBackendTimer
+	histograms map[string]*localBackendHistogram
+	stop       chan struct{}
+	wg         sync.WaitGroup
+	timeNow    func() time.Time
+	TagsSep    string
+	TagKVSep   string
+	// Quantiles reported for timers by SnapshotDetailed, in the (0, 1] range.
+	Quantiles []float64
 }
 
 // NewLocalBackend returns a new LocalBackend. The collectionInterval is the histogram
 // time window for each timer.
 func NewLocalBackend(collectionInterval time.Duration) *LocalBackend {
 	b := &LocalBackend{
-		counters: make(map[string]*int64),
-		gauges:   make(map[string]*int64),
-		timers:   make(map[string]*localBackendTimer),
-		stop:     make(chan struct{}),
-		TagsSep:  "|",
-		TagKVSep: "=",
+		counters:   make(map[string]*int64),
+		rates:      make(map[string]*localCounterRates),
+		gauges:     make(map[string]*int64),
+		timers:     make(map[string]*localBackendTimer),
+		histograms: make(map[string]*localBackendHistogram),
+		series:     make(map[string]localSeries),
+		stop:       make(chan struct{}),
+		timeNow:    time.Now,
+		TagsSep:    "|",
+		TagKVSep:   "=",
+		Quantiles:  []float64{0.5, 0.75, 0.9, 0.95, 0.99, 0.999},
 	}
 	if collectionInterval == 0 {
 		// Use one histogram time window for all timers
@@ -70,9 +84,16 @@ func (b *LocalBackend) Clear() {
 	defer b.gm.Unlock()
 	b.tm.Lock()
 	defer b.tm.Unlock()
+	b.hm.Lock()
+	defer b.hm.Unlock()
+	b.sm.Lock()
+	defer b.sm.Unlock()
+	b.series = make(map[string]localSeries)
 	b.counters = make(map[string]*int64)
+	b.rates = make(map[string]*localCounterRates)
 	b.gauges = make(map[string]*int64)
 	b.timers = make(map[string]*localBackendTimer)
+	b.histograms = make(map[string]*localBackendHistogram)
 }
 
 func (b *LocalBackend) runLoop(collectionInterval time.Duration) {
@@ -102,13 +123,15 @@ func (b *LocalBackend) runLoop(collectionInterval time.Duration) {
 
 // IncCounter increments a counter value
 func (b *LocalBackend) IncCounter(name string, tags map[string]string, delta int64) {
-	name = GetKey(name, tags, b.TagsSep, b.TagKVSep)
+	key := GetKey(name, tags, b.TagsSep, b.TagKVSep)
 	b.cm.Lock()
 	defer b.cm.Unlock()
-	counter := b.counters[name]
+	counter := b.counters[key]
 	if counter == nil {
-		b.counters[name] = new(int64)
-		*b.counters[name] = delta
+		b.counters[key] = new(int64)
+		*b.counters[key] = delta
+		b.rates[key] = newLocalCounterRates(b.timeNow())
+		b.describe(key, name, tags)
 		return
 	}
 	atomic.AddInt64(counter, delta)
@@ -116,13 +139,14 @@ func (b *LocalBackend) IncCounter(name string, tags map[string]string, delta int
 
 // UpdateGauge updates the value of a gauge
 func (b *LocalBackend) UpdateGauge(name string, tags map[string]string, value int64) {
-	name = GetKey(name, tags, b.TagsSep, b.TagKVSep)
+	key := GetKey(name, tags, b.TagsSep, b.TagKVSep)
 	b.gm.Lock()
 	defer b.gm.Unlock()
-	gauge := b.gauges[name]
+	gauge := b.gauges[key]
 	if gauge == nil {
-		b.gauges[name] = new(int64)
-		*b.gauges[name] = value
+		b.gauges[key] = new(int64)
+		*b.gauges[key] = value
+		b.describe(key, name, tags)
 		return
 	}
 	atomic.StoreInt64(gauge, value)
@@ -130,30 +154,104 @@ func (b *LocalBackend) UpdateGauge(name string, tags map[string]string, value in
 
 // RecordTimer records a timing duration
 func (b *LocalBackend) RecordTimer(name string, tags map[string]string, d time.Duration) {
-	name = GetKey(name, tags, b.TagsSep, b.TagKVSep)
-	timer := b.findOrCreateTimer(name)
+	key := GetKey(name, tags, b.TagsSep, b.TagKVSep)
+	timer := b.findOrCreateTimer(key, name, tags)
 	timer.Lock()
 	timer.hist.Current.RecordValue(int64(d / time.Millisecond))
+	timer.count++
+	timer.sum += d
 	timer.Unlock()
 }
 
-func (b *LocalBackend) findOrCreateTimer(name string) *localBackendTimer {
+func (b *LocalBackend) findOrCreateTimer(key, name string, tags map[string]string) *localBackendTimer {
 	b.tm.Lock()
 	defer b.tm.Unlock()
-	if t, ok := b.timers[name]; ok {
+	if t, ok := b.timers[key]; ok {
 		return t
 	}
 
 	t := &localBackendTimer{
-		hist: hdrhistogram.NewWindowed(5, 0, int64((5*time.Minute)/time.Millisecond), 1),
+		hist: newTimerHistogram(),
 	}
-	b.timers[name] = t
+	b.timers[key] = t
+	b.describe(key, name, tags)
 	return t
 }
 
 type localBackendTimer struct {
 	sync.Mutex
 	hist *hdrhistogram.WindowedHistogram
+	// count and sum of all the recorded durations, unlike hist they never decrease.
+	count int64
+	sum   time.Duration
+}
+
+func newTimerHistogram() *hdrhistogram.WindowedHistogram {
+	return hdrhistogram.NewWindowed(5, 0, int64((5*time.Minute)/time.Millisecond), 1)
+}
+
+// RecordHistogram records a value in the histogram. Buckets are fixed when the
+// histogram is first recorded, nil buckets selects defaultHistogramBuckets.
+func (b *LocalBackend) RecordHistogram(name string, tags map[string]string, buckets []float64, value float64) {
+	key := GetKey(name, tags, b.TagsSep, b.TagKVSep)
+	histogram := b.findOrCreateHistogram(key, name, tags, buckets)
+	histogram.Lock()
+	histogram.record(value)
+	histogram.Unlock()
+}
+
+func (b *LocalBackend) findOrCreateHistogram(key, name string, tags map[string]string, buckets []float64) *localBackendHistogram {
+	b.hm.Lock()
+	defer b.hm.Unlock()
+	if h, ok := b.histograms[key]; ok {
+		return h
+	}
+
+	if buckets == nil {
+		buckets = defaultHistogramBuckets
+	}
+	bounds := make([]float64, len(buckets))
+	copy(bounds, buckets)
+	sort.Float64s(bounds)
+	h := &localBackendHistogram{
+		buckets: bounds,
+		counts:  make([]int64, len(bounds)+1),
+	}
+	b.histograms[key] = h
+	b.describe(key, name, tags)
+	return h
+}
+
+// defaultHistogramBuckets are the same defaults the Prometheus client uses.
+var defaultHistogramBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type localBackendHistogram struct {
+	sync.Mutex
+	buckets []float64
+	// counts holds the non cumulative count per bucket, the last one is the +Inf bucket
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func (h *localBackendHistogram) record(value float64) {
+	i := sort.SearchFloat64s(h.buckets, value)
+	h.counts[i]++
+	h.sum += value
+	h.count++
+}
+
+// cumulativeCounts returns the number of observations less than or equal to each bucket,
+// keyed by the bucket upper bound.
+func (h *localBackendHistogram) cumulativeCounts() map[string]int64 {
+	counts := make(map[string]int64, len(h.counts))
+	var total int64
+	for i, bound := range h.buckets {
+		total += h.counts[i]
+		counts[strconv.FormatFloat(bound, 'g', -1, 64)] = total
+	}
+	counts["+Inf"] = h.count
+	return counts
 }
 
 var (
@@ -167,7 +265,8 @@ var (
 	}
 )
 
-// Snapshot captures a snapshot of the current counter and gauge values
+// Snapshot captures a snapshot of the current counter and gauge values.
+// Timer percentiles are reported as gauges and histogram bucket counts as counters.
 func (b *LocalBackend) Snapshot() (counters, gauges map[string]int64) {
 	b.cm.Lock()
 	defer b.cm.Unlock()
@@ -201,9 +300,50 @@ func (b *LocalBackend) Snapshot() (counters, gauges map[string]int64) {
 		}
 	}
 
+	b.hm.Lock()
+	histograms := make(map[string]*localBackendHistogram)
+	for histogramName, histogram := range b.histograms {
+		histograms[histogramName] = histogram
+	}
+	b.hm.Unlock()
+
+	for histogramName, histogram := range histograms {
+		histogram.Lock()
+		buckets := histogram.cumulativeCounts()
+		histogram.Unlock()
+		for bucket, count := range buckets {
+			counters[histogramName+"."+bucket] = count
+		}
+	}
+
 	return
 }
 
+// localSeries keeps the name and tags a key was built from, so the key does not
+// have to be parsed back when exporting.
+type localSeries struct {
+	name string
+	tags map[string]string
+}
+
+// describe records the name and tags of a new key. It is called with the lock
+// of the metric kind held, so sm is always acquired last.
+func (b *LocalBackend) describe(key, name string, tags map[string]string) {
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	b.sm.Lock()
+	defer b.sm.Unlock()
+	b.series[key] = localSeries{name: name, tags: copied}
+}
+
+func (b *LocalBackend) lookupSeries(key string) localSeries {
+	b.sm.Lock()
+	defer b.sm.Unlock()
+	return b.series[key]
+}
+
 // Stop cleanly closes the background goroutine spawned by NewLocalBackend.
 func (b *LocalBackend) Stop() {
 	close(b.stop)
@@ -240,6 +380,15 @@ func (l *localTimer) Record(d time.Duration) {
 	l.localBackend.RecordTimer(l.name, l.tags, d)
 }
 
+type localHistogram struct {
+	stats
+	buckets []float64
+}
+
+func (l *localHistogram) Record(value float64) {
+	l.localBackend.RecordHistogram(l.name, l.tags, l.buckets, value)
+}
+
 type localCounter struct {
 	stats
 }
@@ -322,6 +471,18 @@ func (l *LocalFactory) Gauge(name string, tags map[string]string) Gauge {
 	}
 }
 
+// Histogram returns a local stats histogram.
+func (l *LocalFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	return &localHistogram{
+		stats: stats{
+			name:         l.newNamespace(name),
+			tags:         l.appendTags(tags),
+			localBackend: l.LocalBackend,
+		},
+		buckets: buckets,
+	}
+}
+
 // Namespace returns a new namespace.
 func (l *LocalFactory) Namespace(name string, tags map[string]string) Factory {
 	return &LocalFactory{
@@ -0,0 +1,288 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var timerQuantiles = []float64{0.5, 0.75, 0.9, 0.95, 0.99, 0.999}
+
+type expositionSample struct {
+	suffix string
+	labels map[string]string
+	value  float64
+}
+
+type expositionSeries struct {
+	key     string
+	samples []expositionSample
+}
+
+type expositionFamily struct {
+	name   string
+	kind   string
+	series []expositionSeries
+	keys   map[string]bool
+}
+
+// expositionEntry is a series of the backend to be written by WritePrometheus.
+type expositionEntry struct {
+	series  localSeries
+	key     string
+	kind    string
+	samples func(name string, labels map[string]string) []expositionSample
+}
+
+// WritePrometheus writes the backend data in the Prometheus text exposition format.
+// Counters and gauges are written as is, timers as summaries in seconds and histograms
+// as cumulative histograms. Metric and label names are sanitized to the Prometheus charset.
+// Series colliding after sanitization with a series of another type, or with the same
+// labels, are skipped and reported in a comment.
+func (b *LocalBackend) WritePrometheus(w io.Writer) error {
+	var entries []expositionEntry
+	add := func(key string, kind string, samples func(name string, labels map[string]string) []expositionSample) {
+		entries = append(entries, expositionEntry{series: b.lookupSeries(key), key: key, kind: kind, samples: samples})
+	}
+	single := func(value float64) func(string, map[string]string) []expositionSample {
+		return func(name string, labels map[string]string) []expositionSample {
+			return []expositionSample{{labels: labels, value: value}}
+		}
+	}
+
+	counters, gauges := b.values()
+	for key, value := range counters {
+		add(key, "counter", single(float64(value)))
+	}
+	for key, value := range gauges {
+		add(key, "gauge", single(float64(value)))
+	}
+
+	for key, timer := range b.copyTimers() {
+		timer.Lock()
+		hist := timer.hist.Merge()
+		count, sum := timer.count, timer.sum
+		timer.Unlock()
+		add(key, "summary", func(name string, labels map[string]string) []expositionSample {
+			samples := make([]expositionSample, 0, len(timerQuantiles)+2)
+			for _, q := range timerQuantiles {
+				samples = append(samples, expositionSample{
+					labels: withLabel(labels, "quantile", formatFloat(q)),
+					value:  float64(hist.ValueAtQuantile(q*100)) / 1000,
+				})
+			}
+			// quantiles are windowed, but sum and count are cumulative as Prometheus expects
+			return append(samples,
+				expositionSample{suffix: "_sum", labels: labels, value: sum.Seconds()},
+				expositionSample{suffix: "_count", labels: labels, value: float64(count)},
+			)
+		})
+	}
+
+	for key, histogram := range b.copyHistograms() {
+		histogram.Lock()
+		buckets := make([]float64, len(histogram.buckets))
+		copy(buckets, histogram.buckets)
+		counts := make([]int64, len(histogram.counts))
+		copy(counts, histogram.counts)
+		sum, count := histogram.sum, histogram.count
+		histogram.Unlock()
+		add(key, "histogram", func(name string, labels map[string]string) []expositionSample {
+			samples := make([]expositionSample, 0, len(buckets)+3)
+			var cumulative int64
+			for i, bound := range buckets {
+				cumulative += counts[i]
+				samples = append(samples, expositionSample{
+					suffix: "_bucket",
+					labels: withLabel(labels, "le", formatFloat(bound)),
+					value:  float64(cumulative),
+				})
+			}
+			return append(samples,
+				expositionSample{suffix: "_bucket", labels: withLabel(labels, "le", "+Inf"), value: float64(count)},
+				expositionSample{suffix: "_sum", labels: labels, value: sum},
+				expositionSample{suffix: "_count", labels: labels, value: float64(count)},
+			)
+		})
+	}
+
+	// the first series of a name wins the collisions, whatever the order of the maps
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].series.name != entries[j].series.name {
+			return entries[i].series.name < entries[j].series.name
+		}
+		return entries[i].key < entries[j].key
+	})
+	families := make(map[string]*expositionFamily)
+	var collisions []string
+	for _, entry := range entries {
+		name := sanitizeMetricName(entry.series.name)
+		labels := make(map[string]string, len(entry.series.tags))
+		for k, v := range entry.series.tags {
+			labels[sanitizeLabelName(k)] = v
+		}
+		key := GetKey("", labels, b.TagsSep, b.TagKVSep)
+		family, ok := families[name]
+		if !ok {
+			family = &expositionFamily{name: name, kind: entry.kind, keys: make(map[string]bool)}
+			families[name] = family
+		}
+		if family.kind != entry.kind || family.keys[key] {
+			collisions = append(collisions, entry.key)
+			continue
+		}
+		family.keys[key] = true
+		family.series = append(family.series, expositionSeries{
+			key:     key,
+			samples: entry.samples(name, labels),
+		})
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, key := range collisions {
+		buf.WriteString("# skipped " + strconv.Quote(key) + ", its name collides with another series\n")
+	}
+	for _, name := range names {
+		family := families[name]
+		sort.Slice(family.series, func(i, j int) bool {
+			return family.series[i].key < family.series[j].key
+		})
+		buf.WriteString("# TYPE " + family.name + " " + family.kind + "\n")
+		for _, series := range family.series {
+			for _, sample := range series.samples {
+				buf.WriteString(family.name + sample.suffix)
+				writeLabels(&buf, sample.labels)
+				buf.WriteString(" " + formatFloat(sample.value) + "\n")
+			}
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// PrometheusHandler returns an http.Handler serving WritePrometheus, e.g. to be mounted
+// on /metrics in place of promhttp.Handler().
+func (b *LocalBackend) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		if err := b.WritePrometheus(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (b *LocalBackend) values() (counters, gauges map[string]int64) {
+	b.cm.Lock()
+	counters = make(map[string]int64, len(b.counters))
+	for key, value := range b.counters {
+		counters[key] = atomic.LoadInt64(value)
+	}
+	b.cm.Unlock()
+
+	b.gm.Lock()
+	gauges = make(map[string]int64, len(b.gauges))
+	for key, value := range b.gauges {
+		gauges[key] = atomic.LoadInt64(value)
+	}
+	b.gm.Unlock()
+	return
+}
+
+func (b *LocalBackend) copyTimers() map[string]*localBackendTimer {
+	b.tm.Lock()
+	defer b.tm.Unlock()
+	timers := make(map[string]*localBackendTimer, len(b.timers))
+	for key, timer := range b.timers {
+		timers[key] = timer
+	}
+	return timers
+}
+
+func (b *LocalBackend) copyHistograms() map[string]*localBackendHistogram {
+	b.hm.Lock()
+	defer b.hm.Unlock()
+	histograms := make(map[string]*localBackendHistogram, len(b.histograms))
+	for key, histogram := range b.histograms {
+		histograms[key] = histogram
+	}
+	return histograms
+}
+
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	ret := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		ret[k] = v
+	}
+	ret[name] = value
+	return ret
+}
+
+func writeLabels(buf *bytes.Buffer, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(name + `="` + labelValueEscaper.Replace(labels[name]) + `"`)
+	}
+	buf.WriteByte('}')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sanitizeMetricName(name string) string {
+	return sanitizeName(name, true)
+}
+
+func sanitizeLabelName(name string) string {
+	return sanitizeName(name, false)
+}
+
+func sanitizeName(name string, allowColon bool) string {
+	if name == "" {
+		return "_"
+	}
+	out := []byte(name)
+	for i, c := range out {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9' && i > 0) || (c == ':' && allowColon)
+		if !valid {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
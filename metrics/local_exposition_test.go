@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalWritePrometheus(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	ns := f.Namespace("bender", map[string]string{"a": "b"})
+	ns.Counter("requests", map[string]string{"path": `/x"y`}).Inc(3)
+	ns.Counter("requests", map[string]string{"path": "/"}).Inc(1)
+	f.Gauge("queue-length", nil).Update(-7)
+	f.Histogram("payload.size", nil, []float64{10, 100}).Record(50)
+	f.Timer("latency", nil).Record(2 * time.Second)
+
+	var buf bytes.Buffer
+	require.NoError(t, f.WritePrometheus(&buf))
+
+	// timers are kept in milliseconds with one significant digit of precision
+	assert.Equal(t, `# TYPE bender_requests counter
+bender_requests{a="b",path="/"} 1
+bender_requests{a="b",path="/x\"y"} 3
+# TYPE latency summary
+latency{quantile="0.5"} 2.047
+latency{quantile="0.75"} 2.047
+latency{quantile="0.9"} 2.047
+latency{quantile="0.95"} 2.047
+latency{quantile="0.99"} 2.047
+latency{quantile="0.999"} 2.047
+latency_sum 2
+latency_count 1
+# TYPE payload_size histogram
+payload_size_bucket{le="10"} 0
+payload_size_bucket{le="100"} 1
+payload_size_bucket{le="+Inf"} 1
+payload_size_sum 50
+payload_size_count 1
+# TYPE queue_length gauge
+queue_length -7
+`, buf.String())
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(&buf)
+	require.NoError(t, err)
+	assert.Len(t, families, 4)
+}
+
+func TestLocalWritePrometheusCollisions(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	f.Counter("a.b", map[string]string{"x": "1"}).Inc(1)
+	f.Counter("a_b", map[string]string{"x": "1"}).Inc(2)
+	f.Counter("a-b", map[string]string{"x": "2"}).Inc(3)
+	f.Gauge("a~b", nil).Update(4)
+
+	var buf bytes.Buffer
+	require.NoError(t, f.WritePrometheus(&buf))
+	assert.Equal(t, `# skipped "a_b|x=1", its name collides with another series
+# skipped "a~b", its name collides with another series
+# TYPE a_b counter
+a_b{x="1"} 1
+a_b{x="2"} 3
+`, buf.String())
+
+	var parser expfmt.TextParser
+	_, err := parser.TextToMetricFamilies(&buf)
+	require.NoError(t, err)
+}
+
+func TestLocalWritePrometheusTimerCount(t *testing.T) {
+	b := NewLocalBackend(0)
+	defer b.Stop()
+	b.RecordTimer("latency", nil, time.Second)
+	b.RecordTimer("latency", nil, time.Second)
+	b.SnapshotDetailedAndReset()
+	b.RecordTimer("latency", nil, time.Second)
+
+	var buf bytes.Buffer
+	require.NoError(t, b.WritePrometheus(&buf))
+	assert.Contains(t, buf.String(), "latency_sum 3\nlatency_count 3\n")
+}
+
+func TestLocalPrometheusHandler(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	f.Counter("hits", nil).Inc(2)
+
+	server := httptest.NewServer(f.PrometheusHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, PrometheusContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "# TYPE hits counter\nhits 2\n", string(body))
+}
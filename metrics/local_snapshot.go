@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// DetailedSnapshot is a typed snapshot of a LocalBackend, keyed like Snapshot.
+type DetailedSnapshot struct {
+	Counters   map[string]CounterSnapshot
+	Gauges     map[string]int64
+	Timers     map[string]TimerSnapshot
+	Histograms map[string]HistogramSnapshot
+}
+
+// CounterSnapshot holds the value of a counter and its exponentially-weighted
+// per second rates over the last 1, 5 and 15 minutes.
+type CounterSnapshot struct {
+	Value  int64
+	Rate1  float64
+	Rate5  float64
+	Rate15 float64
+}
+
+// TimerSnapshot summarizes the durations recorded by a timer. Quantiles are keyed
+// by the quantiles configured in LocalBackend.Quantiles.
+type TimerSnapshot struct {
+	Count     int64
+	Min       time.Duration
+	Max       time.Duration
+	Mean      time.Duration
+	Quantiles map[float64]time.Duration
+}
+
+// HistogramSnapshot holds the cumulative count per bucket upper bound of a histogram,
+// including the math.Inf(1) bucket.
+type HistogramSnapshot struct {
+	Count   int64
+	Sum     float64
+	Buckets map[float64]int64
+}
+
+// SnapshotDetailed captures a typed snapshot of all counters, gauges, timers and histograms.
+func (b *LocalBackend) SnapshotDetailed() *DetailedSnapshot {
+	return b.snapshotDetailed(false)
+}
+
+// SnapshotDetailedAndReset captures a typed snapshot like SnapshotDetailed and then resets
+// counters, timers and histograms, so periodic reporters receive the values accumulated
+// since their previous call. Gauges and counter rates are kept.
+func (b *LocalBackend) SnapshotDetailedAndReset() *DetailedSnapshot {
+	return b.snapshotDetailed(true)
+}
+
+func (b *LocalBackend) snapshotDetailed(reset bool) *DetailedSnapshot {
+	now := b.timeNow()
+	s := &DetailedSnapshot{
+		Gauges: make(map[string]int64),
+	}
+
+	b.cm.Lock()
+	s.Counters = make(map[string]CounterSnapshot, len(b.counters))
+	for key, counter := range b.counters {
+		var value int64
+		if reset {
+			value = atomic.SwapInt64(counter, 0)
+		} else {
+			value = atomic.LoadInt64(counter)
+		}
+		rates := b.rates[key]
+		rates.tick(now, value)
+		if reset {
+			rates.last -= value
+		}
+		s.Counters[key] = CounterSnapshot{
+			Value:  value,
+			Rate1:  rates.m1.rate,
+			Rate5:  rates.m5.rate,
+			Rate15: rates.m15.rate,
+		}
+	}
+	b.cm.Unlock()
+
+	b.gm.Lock()
+	for key, gauge := range b.gauges {
+		s.Gauges[key] = atomic.LoadInt64(gauge)
+	}
+	b.gm.Unlock()
+
+	timers := b.copyTimers()
+	s.Timers = make(map[string]TimerSnapshot, len(timers))
+	for key, timer := range timers {
+		timer.Lock()
+		hist := timer.hist.Merge()
+		if reset {
+			timer.hist = newTimerHistogram()
+		}
+		timer.Unlock()
+		ts := TimerSnapshot{
+			Count:     hist.TotalCount(),
+			Min:       time.Duration(hist.Min()) * time.Millisecond,
+			Max:       time.Duration(hist.Max()) * time.Millisecond,
+			Mean:      time.Duration(hist.Mean() * float64(time.Millisecond)),
+			Quantiles: make(map[float64]time.Duration, len(b.Quantiles)),
+		}
+		for _, q := range b.Quantiles {
+			ts.Quantiles[q] = time.Duration(hist.ValueAtQuantile(q*100)) * time.Millisecond
+		}
+		s.Timers[key] = ts
+	}
+
+	histograms := b.copyHistograms()
+	s.Histograms = make(map[string]HistogramSnapshot, len(histograms))
+	for key, histogram := range histograms {
+		histogram.Lock()
+		hs := HistogramSnapshot{
+			Count:   histogram.count,
+			Sum:     histogram.sum,
+			Buckets: make(map[float64]int64, len(histogram.counts)),
+		}
+		var cumulative int64
+		for i, bound := range histogram.buckets {
+			cumulative += histogram.counts[i]
+			hs.Buckets[bound] = cumulative
+		}
+		hs.Buckets[math.Inf(1)] = histogram.count
+		if reset {
+			histogram.counts = make([]int64, len(histogram.counts))
+			histogram.sum = 0
+			histogram.count = 0
+		}
+		histogram.Unlock()
+		s.Histograms[key] = hs
+	}
+	return s
+}
+
+// ewmaTickInterval is the interval at which counter rates are decayed, same as in
+// the Unix load average and in github.com/rcrowley/go-metrics.
+const ewmaTickInterval = 5 * time.Second
+
+type ewma struct {
+	alpha       float64
+	rate        float64
+	initialized bool
+}
+
+func newEWMA(minutes float64) ewma {
+	return ewma{alpha: 1 - math.Exp(-ewmaTickInterval.Minutes()/minutes)}
+}
+
+// tick applies ticks ticks with the given rate.
+func (e *ewma) tick(rate float64, ticks int64) {
+	if !e.initialized {
+		e.rate = rate
+		e.initialized = true
+		return
+	}
+	e.rate = rate + (e.rate-rate)*math.Pow(1-e.alpha, float64(ticks))
+}
+
+// localCounterRates computes counter rates lazily: ticks that elapsed since the previous
+// snapshot are replayed with the average rate of the counter since that snapshot, so the
+// rates do not depend on how often snapshots are taken.
+type localCounterRates struct {
+	lastTick time.Time
+	lastSeen time.Time
+	last     int64
+	m1       ewma
+	m5       ewma
+	m15      ewma
+}
+
+func newLocalCounterRates(now time.Time) *localCounterRates {
+	return &localCounterRates{
+		lastTick: now,
+		lastSeen: now,
+		m1:       newEWMA(1),
+		m5:       newEWMA(5),
+		m15:      newEWMA(15),
+	}
+}
+
+func (r *localCounterRates) tick(now time.Time, value int64) {
+	ticks := int64(now.Sub(r.lastTick) / ewmaTickInterval)
+	if ticks <= 0 {
+		return
+	}
+	rate := float64(value-r.last) / now.Sub(r.lastSeen).Seconds()
+	r.m1.tick(rate, ticks)
+	r.m5.tick(rate, ticks)
+	r.m15.tick(rate, ticks)
+	r.last = value
+	r.lastSeen = now
+	r.lastTick = r.lastTick.Add(time.Duration(ticks) * ewmaTickInterval)
+}
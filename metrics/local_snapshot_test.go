@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLocalSnapshotDetailed(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	f.Quantiles = []float64{0.5, 1}
+
+	timer := f.Timer("latency", map[string]string{"x": "y"})
+	timer.Record(4 * time.Millisecond)
+	timer.Record(8 * time.Millisecond)
+	timer.Record(16 * time.Millisecond)
+	f.Gauge("level", nil).Update(12)
+	f.Histogram("size", nil, []float64{1, 10}).Record(5)
+
+	s := f.SnapshotDetailed()
+	require.Contains(t, s.Timers, "latency|x=y")
+	ts := s.Timers["latency|x=y"]
+	assert.EqualValues(t, 3, ts.Count)
+	assert.Equal(t, 4*time.Millisecond, ts.Min)
+	assert.Equal(t, 16*time.Millisecond, ts.Max)
+	assert.InDelta(t, 28*float64(time.Millisecond)/3, float64(ts.Mean), 1)
+	assert.Equal(t, map[float64]time.Duration{
+		0.5: 8 * time.Millisecond,
+		1:   16 * time.Millisecond,
+	}, ts.Quantiles)
+	assert.Equal(t, map[string]int64{"level": 12}, s.Gauges)
+	assert.Equal(t, HistogramSnapshot{
+		Count:   1,
+		Sum:     5,
+		Buckets: map[float64]int64{1: 0, 10: 1, math.Inf(1): 1},
+	}, s.Histograms["size"])
+}
+
+func TestLocalSnapshotDetailedRates(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	f.timeNow = clock.Now
+
+	counter := f.Counter("requests", nil)
+	counter.Inc(50)
+
+	s := f.SnapshotDetailed()
+	assert.Equal(t, CounterSnapshot{Value: 50}, s.Counters["requests"], "no tick has elapsed yet")
+
+	clock.Add(5 * time.Second)
+	s = f.SnapshotDetailed()
+	assert.Equal(t, CounterSnapshot{Value: 50, Rate1: 10, Rate5: 10, Rate15: 10}, s.Counters["requests"])
+
+	clock.Add(5 * time.Second)
+	s = f.SnapshotDetailed()
+	assert.InDelta(t, 10*math.Exp(-1.0/12), s.Counters["requests"].Rate1, 1e-9)
+	assert.InDelta(t, 10*math.Exp(-1.0/60), s.Counters["requests"].Rate5, 1e-9)
+	assert.InDelta(t, 10*math.Exp(-1.0/180), s.Counters["requests"].Rate15, 1e-9)
+
+	clock.Add(time.Hour)
+	s = f.SnapshotDetailed()
+	assert.InDelta(t, 0, s.Counters["requests"].Rate1, 1e-9)
+	assert.EqualValues(t, 50, s.Counters["requests"].Value)
+}
+
+func TestLocalSnapshotDetailedRatesInterval(t *testing.T) {
+	for _, interval := range []time.Duration{time.Second, 5 * time.Second, time.Minute} {
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		f := NewLocalFactory(0)
+		f.timeNow = clock.Now
+		counter := f.Counter("requests", nil)
+
+		// a steady 10 requests per second for 10 minutes
+		var s *DetailedSnapshot
+		for elapsed := time.Duration(0); elapsed < 10*time.Minute; elapsed += interval {
+			counter.Inc(int64(10 * interval / time.Second))
+			clock.Add(interval)
+			s = f.SnapshotDetailed()
+		}
+		f.Stop()
+		assert.InDelta(t, 10, s.Counters["requests"].Rate1, 1e-9, "snapshots every %s", interval)
+		assert.InDelta(t, 10, s.Counters["requests"].Rate5, 1e-9, "snapshots every %s", interval)
+	}
+}
+
+func TestLocalSnapshotDetailedAndReset(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	f.timeNow = clock.Now
+
+	counter := f.Counter("requests", nil)
+	counter.Inc(20)
+	f.Timer("latency", nil).Record(time.Millisecond)
+	f.Gauge("level", nil).Update(3)
+	f.Histogram("size", nil, nil).Record(1)
+
+	s := f.SnapshotDetailedAndReset()
+	assert.EqualValues(t, 20, s.Counters["requests"].Value)
+	assert.EqualValues(t, 1, s.Timers["latency"].Count)
+	assert.EqualValues(t, 1, s.Histograms["size"].Count)
+
+	counter.Inc(30)
+	clock.Add(5 * time.Second)
+	s = f.SnapshotDetailedAndReset()
+	assert.EqualValues(t, 30, s.Counters["requests"].Value)
+	assert.EqualValues(t, 10, s.Counters["requests"].Rate1, "rate covers increments from before the reset")
+	assert.EqualValues(t, 0, s.Timers["latency"].Count)
+	assert.EqualValues(t, 0, s.Histograms["size"].Count)
+	assert.EqualValues(t, 3, s.Gauges["level"])
+
+	clock.Add(5 * time.Second)
+	s = f.SnapshotDetailed()
+	assert.EqualValues(t, 0, s.Counters["requests"].Value)
+	assert.InDelta(t, 10*math.Exp(-1.0/12), s.Counters["requests"].Rate1, 1e-9)
+}
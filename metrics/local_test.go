@@ -79,6 +79,37 @@ func TestLocalMetrics(t *testing.T) {
 	require.Empty(t, g)
 }
 
+func TestLocalHistogram(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	h := f.Namespace("namespace", map[string]string{"x": "y"}).Histogram("payload-size", nil, []float64{100, 10, 1000})
+	h.Record(5)
+	h.Record(10)
+	h.Record(500)
+	h.Record(5000)
+	f.Histogram("batch-size", nil, nil).Record(0.3)
+
+	c, _ := f.Snapshot()
+	assert.Equal(t, map[string]int64{
+		"namespace.payload-size|x=y.10":   2,
+		"namespace.payload-size|x=y.100":  2,
+		"namespace.payload-size|x=y.1000": 3,
+		"namespace.payload-size|x=y.+Inf": 4,
+		"batch-size.0.005":                0,
+		"batch-size.0.01":                 0,
+		"batch-size.0.025":                0,
+		"batch-size.0.05":                 0,
+		"batch-size.0.1":                  0,
+		"batch-size.0.25":                 0,
+		"batch-size.0.5":                  1,
+		"batch-size.1":                    1,
+		"batch-size.2.5":                  1,
+		"batch-size.5":                    1,
+		"batch-size.10":                   1,
+		"batch-size.+Inf":                 1,
+	}, c)
+}
+
 func TestLocalMetricsInterval(t *testing.T) {
 	refreshInterval := time.Millisecond
 	const relativeCheckFrequency = 5 // check 5 times per refreshInterval
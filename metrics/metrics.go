@@ -17,6 +17,7 @@ package metrics
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -28,33 +29,45 @@ func Init(metrics interface{}, factory Factory, globalTags map[string]string) {
 }
 
 // initMetrics uses reflection to initialize a struct containing metrics fields
-// by assigning new Counter/Gauge/Timer values with the metric name retrieved
+// by assigning new Counter/Gauge/Timer/Histogram values with the metric name retrieved
 // from the `metric` tag and stats tags retrieved from the `tags` tag.
+// Histogram buckets are retrieved from the optional `buckets` tag, e.g. `buckets:"1,10,100"`,
+// and the description from the optional `help` tag. Factories implementing OptionsFactory
+// use both, and timer buckets in seconds as well.
 //
-// Note: all fields of the struct must be exported, have a `metric` tag, and be
-// of type Counter or Gauge or Timer.
+// Fields that are structs or pointers to structs are initialized recursively, in the
+// namespace of their `metric` tag if present, and with their `tags` added to the global tags.
+// Fields tagged `metric:"-"` are skipped.
+//
+// Note: all other fields of the struct must be exported, have a `metric` tag, and be
+// of type Counter or Gauge or Timer or Histogram.
 func initMetrics(m interface{}, factory Factory, globalTags map[string]string) error {
 	// Allow user to opt out of reporting metrics by passing in nil.
 	if factory == nil {
 		factory = NullFactory
 	}
+	return initStruct(reflect.ValueOf(m).Elem(), factory, globalTags)
+}
 
-	counterPtrType := reflect.TypeOf((*Counter)(nil)).Elem()
-	gaugePtrType := reflect.TypeOf((*Gauge)(nil)).Elem()
-	timerPtrType := reflect.TypeOf((*Timer)(nil)).Elem()
+var (
+	counterPtrType   = reflect.TypeOf((*Counter)(nil)).Elem()
+	gaugePtrType     = reflect.TypeOf((*Gauge)(nil)).Elem()
+	timerPtrType     = reflect.TypeOf((*Timer)(nil)).Elem()
+	histogramPtrType = reflect.TypeOf((*Histogram)(nil)).Elem()
+)
 
-	v := reflect.ValueOf(m).Elem()
+func initStruct(v reflect.Value, factory Factory, globalTags map[string]string) error {
 	t := v.Type()
 	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		metric := field.Tag.Get("metric")
+		if metric == "-" {
+			continue
+		}
 		tags := make(map[string]string)
 		for k, v := range globalTags {
 			tags[k] = v
 		}
-		field := t.Field(i)
-		metric := field.Tag.Get("metric")
-		if metric == "" {
-			return fmt.Errorf("Field %s is missing a tag 'metric'", field.Name)
-		}
 		if tagString := field.Tag.Get("tags"); tagString != "" {
 			tagPairs := strings.Split(tagString, ",")
 			for _, tagPair := range tagPairs {
@@ -67,19 +80,73 @@ func initMetrics(m interface{}, factory Factory, globalTags map[string]string) e
 				tags[tag[0]] = tag[1]
 			}
 		}
+		if nested, ok := nestedStruct(v.Field(i), field); ok {
+			if field.PkgPath != "" {
+				return fmt.Errorf("Field %s is not exported", field.Name)
+			}
+			nestedFactory := factory
+			if metric != "" {
+				nestedFactory = factory.Namespace(metric, nil)
+			}
+			if err := initStruct(nested, nestedFactory, tags); err != nil {
+				return err
+			}
+			continue
+		}
+		if metric == "" {
+			return fmt.Errorf("Field %s is missing a tag 'metric'", field.Name)
+		}
+		if field.PkgPath != "" {
+			return fmt.Errorf("Field %s is not exported", field.Name)
+		}
+		var buckets []float64
+		if bucketString := field.Tag.Get("buckets"); bucketString != "" {
+			for _, bucket := range strings.Split(bucketString, ",") {
+				b, err := strconv.ParseFloat(strings.TrimSpace(bucket), 64)
+				if err != nil {
+					return fmt.Errorf(
+						"Field [%s]: Bucket [%s] is not a number in 'buckets' string [%s]",
+						field.Name, bucket, bucketString)
+				}
+				buckets = append(buckets, b)
+			}
+		}
+		opts := MetricOptions{
+			Name:    metric,
+			Tags:    tags,
+			Help:    field.Tag.Get("help"),
+			Buckets: buckets,
+		}
 		var obj interface{}
 		if field.Type.AssignableTo(counterPtrType) {
-			obj = factory.Counter(metric, tags)
+			obj = counterWithOptions(factory, opts)
 		} else if field.Type.AssignableTo(gaugePtrType) {
-			obj = factory.Gauge(metric, tags)
+			obj = gaugeWithOptions(factory, opts)
 		} else if field.Type.AssignableTo(timerPtrType) {
-			obj = factory.Timer(metric, tags)
+			obj = timerWithOptions(factory, opts)
+		} else if field.Type.AssignableTo(histogramPtrType) {
+			obj = histogramWithOptions(factory, opts)
 		} else {
 			return fmt.Errorf(
-				"Field %s is not a pointer to timer, gauge, or counter",
+				"Field %s is not a pointer to timer, gauge, counter, or histogram",
 				field.Name)
 		}
 		v.Field(i).Set(reflect.ValueOf(obj))
 	}
 	return nil
 }
+
+// nestedStruct returns the struct held by a field of struct type, allocating it if the
+// field is a nil pointer to a struct.
+func nestedStruct(v reflect.Value, field reflect.StructField) (reflect.Value, bool) {
+	switch {
+	case field.Type.Kind() == reflect.Struct:
+		return v, true
+	case field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct:
+		if v.IsNil() && field.PkgPath == "" {
+			v.Set(reflect.New(field.Type.Elem()))
+		}
+		return v.Elem(), true
+	}
+	return reflect.Value{}, false
+}
@@ -46,6 +46,58 @@ func TestInitMetrics(t *testing.T) {
 	assert.True(t, 0 < stopwatch.ElapsedTime())
 }
 
+func TestInitHistogram(t *testing.T) {
+	testMetrics := struct {
+		Histogram Histogram `metric:"histogram" buckets:"10, 100"`
+	}{}
+
+	f := NewLocalFactory(0)
+	defer f.Stop()
+
+	err := initMetrics(&testMetrics, f, map[string]string{"key": "value"})
+	assert.NoError(t, err)
+
+	testMetrics.Histogram.Record(42)
+
+	c, _ := f.Snapshot()
+	assert.EqualValues(t, 0, c["histogram|key=value.10"])
+	assert.EqualValues(t, 1, c["histogram|key=value.100"])
+}
+
+type httpMetrics struct {
+	Requests Counter `metric:"requests" help:"Number of requests"`
+	Latency  Timer   `metric:"latency"`
+}
+
+func TestInitNestedMetrics(t *testing.T) {
+	testMetrics := struct {
+		HTTP    httpMetrics  `metric:"http" tags:"server=api"`
+		Client  *httpMetrics `metric:"client"`
+		Flat    httpMetrics
+		Ignored int     `metric:"-"`
+		Counter Counter `metric:"counter"`
+	}{}
+
+	f := NewLocalFactory(0)
+	defer f.Stop()
+
+	err := initMetrics(&testMetrics, f, map[string]string{"key": "value"})
+	assert.NoError(t, err)
+
+	testMetrics.HTTP.Requests.Inc(1)
+	testMetrics.Client.Requests.Inc(2)
+	testMetrics.Flat.Requests.Inc(3)
+	testMetrics.Counter.Inc(4)
+
+	c, _ := f.Snapshot()
+	assert.Equal(t, map[string]int64{
+		"http.requests|key=value|server=api": 1,
+		"client.requests|key=value":          2,
+		"requests|key=value":                 3,
+		"counter|key=value":                  4,
+	}, c)
+}
+
 var (
 	noMetricTag = struct {
 		NoMetricTag Counter
@@ -55,6 +107,20 @@ var (
 		BadTags Counter `metric:"counter" tags:"1=one,noValue"`
 	}{}
 
+	badBuckets = struct {
+		BadBuckets Histogram `metric:"histogram" buckets:"1,ten"`
+	}{}
+
+	unexportedField = struct {
+		counter Counter `metric:"counter"`
+	}{}
+
+	nestedNoMetricTag = struct {
+		Nested struct {
+			NoMetricTag Counter
+		} `metric:"nested"`
+	}{}
+
 	invalidMetricType = struct {
 		InvalidMetricType int64 `metric:"counter"`
 	}{}
@@ -66,8 +132,15 @@ func TestInitMetricsFailures(t *testing.T) {
 	assert.EqualError(t, initMetrics(&badTags, nil, nil),
 		"Field [BadTags]: Tag [noValue] is not of the form key=value in 'tags' string [1=one,noValue]")
 
+	assert.EqualError(t, initMetrics(&badBuckets, nil, nil),
+		"Field [BadBuckets]: Bucket [ten] is not a number in 'buckets' string [1,ten]")
+
+	assert.EqualError(t, initMetrics(&unexportedField, nil, nil), "Field counter is not exported")
+
+	assert.EqualError(t, initMetrics(&nestedNoMetricTag, nil, nil), "Field NoMetricTag is missing a tag 'metric'")
+
 	assert.EqualError(t, initMetrics(&invalidMetricType, nil, nil),
-		"Field InvalidMetricType is not a pointer to timer, gauge, or counter")
+		"Field InvalidMetricType is not a pointer to timer, gauge, counter, or histogram")
 }
 
 func TestInitPanic(t *testing.T) {
@@ -85,5 +158,6 @@ func TestNullMetrics(t *testing.T) {
 	NullFactory.Timer("name", nil).Record(0)
 	NullFactory.Counter("name", nil).Inc(0)
 	NullFactory.Gauge("name", nil).Update(0)
+	NullFactory.Histogram("name", nil, nil).Record(0)
 	NullFactory.Namespace("name", nil).Gauge("name2", nil).Update(0)
 }
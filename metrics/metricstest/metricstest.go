@@ -0,0 +1,232 @@
+// Package metricstest provides a metrics.Factory for tests together with assertions
+// on the metrics it created, for both LocalFactory and PrometheusFactory backends.
+package metricstest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promModel "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liornabat/golibs/metrics"
+)
+
+// Factory is a metrics.Factory whose metrics can be asserted on.
+type Factory struct {
+	metrics.Factory
+	source source
+}
+
+type snapshot struct {
+	counters   map[string]float64
+	gauges     map[string]float64
+	timers     map[string]float64
+	histograms map[string]float64
+}
+
+type source interface {
+	snapshot() (*snapshot, error)
+	key(name string, tags map[string]string) string
+}
+
+// NewFactory returns a Factory backed by a metrics.LocalFactory.
+func NewFactory() *Factory {
+	return NewLocalFactory(metrics.NewLocalFactory(0))
+}
+
+// NewLocalFactory returns a Factory asserting on the given LocalFactory. Names are
+// matched as reported by LocalFactory, namespaces joined with ".".
+func NewLocalFactory(f *metrics.LocalFactory) *Factory {
+	return &Factory{Factory: f, source: &localSource{backend: f.LocalBackend}}
+}
+
+// NewPrometheusFactory returns a Factory backed by a metrics.PrometheusFactory with a private registry.
+func NewPrometheusFactory(opts ...metrics.Option) *Factory {
+	registry := prometheus.NewPedanticRegistry()
+	opts = append(opts, metrics.WithRegisterer(registry))
+	return NewGathererFactory(metrics.New(opts...), registry)
+}
+
+// NewGathererFactory returns a Factory asserting on the metrics gathered from g, e.g. the
+// registry of a PrometheusFactory. Names are compared after replacing ".", "-" and ":"
+// with "_", so the names used with NewFactory match as well.
+func NewGathererFactory(f metrics.Factory, g prometheus.Gatherer) *Factory {
+	return &Factory{Factory: f, source: &gathererSource{gatherer: g}}
+}
+
+// AssertCounter asserts that the counter with the given name and tags has the given value.
+func (f *Factory) AssertCounter(t assert.TestingT, name string, tags map[string]string, value int64) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	return f.assertValue(t, "counter", func(s *snapshot) map[string]float64 { return s.counters }, name, tags, float64(value))
+}
+
+// AssertGauge asserts that the gauge with the given name and tags has the given value.
+func (f *Factory) AssertGauge(t assert.TestingT, name string, tags map[string]string, value int64) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	return f.assertValue(t, "gauge", func(s *snapshot) map[string]float64 { return s.gauges }, name, tags, float64(value))
+}
+
+// AssertGaugeEventually asserts that the gauge with the given name and tags reaches the
+// given value within timeout, e.g. for gauges updated by a background reporter.
+func (f *Factory) AssertGaugeEventually(t assert.TestingT, name string, tags map[string]string, value int64, timeout time.Duration) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	key := f.source.key(name, tags)
+	deadline := time.Now().Add(timeout)
+	for {
+		s, err := f.source.snapshot()
+		if err == nil {
+			if v, ok := s.gauges[key]; ok && v == float64(value) {
+				return true
+			}
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(timeout / 100)
+	}
+	return f.assertValue(t, "gauge", func(s *snapshot) map[string]float64 { return s.gauges }, name, tags, float64(value))
+}
+
+// AssertTimerCount asserts the number of durations recorded by the timer with the given name and tags.
+func (f *Factory) AssertTimerCount(t assert.TestingT, name string, tags map[string]string, count int64) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	return f.assertValue(t, "timer", func(s *snapshot) map[string]float64 { return s.timers }, name, tags, float64(count))
+}
+
+// AssertHistogramCount asserts the number of values recorded by the histogram with the given name and tags.
+func (f *Factory) AssertHistogramCount(t assert.TestingT, name string, tags map[string]string, count int64) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	return f.assertValue(t, "histogram", func(s *snapshot) map[string]float64 { return s.histograms }, name, tags, float64(count))
+}
+
+func (f *Factory) assertValue(t assert.TestingT, kind string, values func(*snapshot) map[string]float64,
+	name string, tags map[string]string, expected float64) bool {
+	s, err := f.source.snapshot()
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("cannot snapshot metrics: %v", err))
+	}
+	key := f.source.key(name, tags)
+	actual, ok := values(s)[key]
+	if ok && actual == expected {
+		return true
+	}
+	var msg string
+	if ok {
+		msg = fmt.Sprintf("%s %q: expected %v, actual %v", kind, key, formatValue(expected), formatValue(actual))
+	} else {
+		msg = fmt.Sprintf("%s %q not found", kind, key)
+	}
+	return assert.Fail(t, msg+"\n"+describe(kind, values(s)))
+}
+
+// describe lists the known series of a kind, so typos in names or tags are easy to spot.
+func describe(kind string, values map[string]float64) string {
+	if len(values) == 0 {
+		return fmt.Sprintf("no %s series were recorded", kind)
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys)+1)
+	lines = append(lines, fmt.Sprintf("recorded %s series:", kind))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("\t%s = %v", k, formatValue(values[k])))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatValue(v float64) string {
+	return fmt.Sprintf("%g", v)
+}
+
+type localSource struct {
+	backend *metrics.LocalBackend
+}
+
+func (l *localSource) key(name string, tags map[string]string) string {
+	return metrics.GetKey(name, tags, l.backend.TagsSep, l.backend.TagKVSep)
+}
+
+func (l *localSource) snapshot() (*snapshot, error) {
+	detailed := l.backend.SnapshotDetailed()
+	s := &snapshot{
+		counters:   make(map[string]float64, len(detailed.Counters)),
+		gauges:     make(map[string]float64, len(detailed.Gauges)),
+		timers:     make(map[string]float64, len(detailed.Timers)),
+		histograms: make(map[string]float64, len(detailed.Histograms)),
+	}
+	for k, c := range detailed.Counters {
+		s.counters[k] = float64(c.Value)
+	}
+	for k, g := range detailed.Gauges {
+		s.gauges[k] = float64(g)
+	}
+	for k, timer := range detailed.Timers {
+		s.timers[k] = float64(timer.Count)
+	}
+	for k, h := range detailed.Histograms {
+		s.histograms[k] = float64(h.Count)
+	}
+	return s, nil
+}
+
+// gathererSource cannot tell timers from histograms, both are Prometheus histograms.
+type gathererSource struct {
+	gatherer prometheus.Gatherer
+}
+
+var nameNormalizer = strings.NewReplacer(".", "_", "-", "_", ":", "_")
+
+func (g *gathererSource) key(name string, tags map[string]string) string {
+	return metrics.GetKey(nameNormalizer.Replace(name), tags, "|", "=")
+}
+
+func (g *gathererSource) snapshot() (*snapshot, error) {
+	families, err := g.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]float64),
+		timers:     make(map[string]float64),
+		histograms: make(map[string]float64),
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			tags := make(map[string]string, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				tags[l.GetName()] = l.GetValue()
+			}
+			key := g.key(family.GetName(), tags)
+			switch family.GetType() {
+			case promModel.MetricType_COUNTER:
+				s.counters[key] = m.GetCounter().GetValue()
+			case promModel.MetricType_GAUGE:
+				s.gauges[key] = m.GetGauge().GetValue()
+			case promModel.MetricType_HISTOGRAM:
+				s.timers[key] = float64(m.GetHistogram().GetSampleCount())
+				s.histograms[key] = float64(m.GetHistogram().GetSampleCount())
+			case promModel.MetricType_SUMMARY:
+				s.timers[key] = float64(m.GetSummary().GetSampleCount())
+			}
+		}
+	}
+	return s, nil
+}
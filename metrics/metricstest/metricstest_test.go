@@ -0,0 +1,87 @@
+package metricstest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liornabat/golibs/metrics"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	for name, f := range map[string]*Factory{
+		"local":      NewFactory(),
+		"prometheus": NewPrometheusFactory(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ns := f.Namespace("http", map[string]string{"service": "api"})
+			ns.Counter("requests", map[string]string{"code": "200"}).Inc(3)
+			ns.Gauge("in_flight", nil).Update(2)
+			ns.Timer("latency", nil).Record(time.Millisecond)
+			ns.Timer("latency", nil).Record(2 * time.Millisecond)
+			ns.Histogram("size", nil, []float64{10, 100}).Record(42)
+
+			f.AssertCounter(t, "http.requests", map[string]string{"service": "api", "code": "200"}, 3)
+			f.AssertGauge(t, "http.in_flight", map[string]string{"service": "api"}, 2)
+			f.AssertTimerCount(t, "http.latency", map[string]string{"service": "api"}, 2)
+			f.AssertHistogramCount(t, "http.size", map[string]string{"service": "api"}, 1)
+		})
+	}
+}
+
+func TestAssertionFailures(t *testing.T) {
+	f := NewFactory()
+	f.Counter("requests", map[string]string{"code": "200"}).Inc(3)
+	f.Counter("requests", map[string]string{"code": "500"}).Inc(1)
+
+	r := &recordingT{}
+	assert.False(t, f.AssertCounter(r, "requests", map[string]string{"code": "200"}, 4))
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], `counter "requests|code=200": expected 4, actual 3`)
+	assert.Contains(t, r.errors[0], "requests|code=500 = 1")
+
+	r = &recordingT{}
+	assert.False(t, f.AssertCounter(r, "request", nil, 1))
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], `counter "request" not found`)
+	assert.Contains(t, r.errors[0], "recorded counter series:")
+
+	r = &recordingT{}
+	assert.False(t, f.AssertGauge(r, "level", nil, 1))
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "no gauge series were recorded")
+}
+
+func TestAssertGaugeEventually(t *testing.T) {
+	f := NewFactory()
+	gauge := f.Gauge("queue_length", nil)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		gauge.Update(5)
+	}()
+	f.AssertGaugeEventually(t, "queue_length", nil, 5, time.Second)
+
+	r := &recordingT{}
+	assert.False(t, f.AssertGaugeEventually(r, "queue_length", nil, 6, 10*time.Millisecond))
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "expected 6, actual 5")
+}
+
+func TestNewLocalFactory(t *testing.T) {
+	local := metrics.NewLocalFactory(0)
+	defer local.Stop()
+	f := NewLocalFactory(local)
+	local.Counter("direct", nil).Inc(1)
+	f.AssertCounter(t, "direct", nil, 1)
+}
@@ -0,0 +1,271 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// defaultOTelInstrumentationName is the name of the meter used by OTelFactory.
+const defaultOTelInstrumentationName = "github.com/liornabat/golibs/metrics"
+
+// OTelFactory implements metrics.Factory backed by an OpenTelemetry MeterProvider.
+// Counters map to Int64Counter, gauges to Int64Gauge, and timers and histograms to
+// Float64Histogram, timers recording seconds. Namespaces are joined with "." and their
+// tags become attributes of every measurement.
+type OTelFactory struct {
+	meter   otelmetric.Meter
+	scope   string
+	tags    map[string]string
+	buckets []float64
+}
+
+type otelOptions struct {
+	instrumentationName string
+	buckets             []float64
+}
+
+// OTelOption is a function that sets some option for the OTelFactory constructor.
+type OTelOption func(*otelOptions)
+
+// WithOTelInstrumentationName returns an option that sets the name of the meter.
+// If not used we fallback to the import path of this package.
+func WithOTelInstrumentationName(name string) OTelOption {
+	return func(opts *otelOptions) {
+		opts.instrumentationName = name
+	}
+}
+
+// WithOTelBuckets returns an option that sets the default buckets of timers, in seconds,
+// and histograms. If not used, we fallback to the default buckets of the MeterProvider.
+func WithOTelBuckets(buckets []float64) OTelOption {
+	return func(opts *otelOptions) {
+		opts.buckets = buckets
+	}
+}
+
+// NewOTelFactory creates an OTelFactory creating its instruments with a meter of provider.
+// Errors of invalid instruments are reported to the global OpenTelemetry error handler.
+func NewOTelFactory(provider otelmetric.MeterProvider, opts ...OTelOption) *OTelFactory {
+	options := &otelOptions{instrumentationName: defaultOTelInstrumentationName}
+	for _, o := range opts {
+		o(options)
+	}
+	return &OTelFactory{
+		meter:   provider.Meter(options.instrumentationName),
+		buckets: options.buckets,
+	}
+}
+
+// Counter implements Counter of metrics.Factory.
+func (f *OTelFactory) Counter(name string, tags map[string]string) Counter {
+	c, err := f.meter.Int64Counter(f.subScope(name))
+	if err != nil {
+		otel.Handle(err)
+	}
+	if c == nil {
+		return NullCounter
+	}
+	return &otelCounter{counter: c, attributes: f.attributes(tags)}
+}
+
+// Gauge implements Gauge of metrics.Factory.
+func (f *OTelFactory) Gauge(name string, tags map[string]string) Gauge {
+	g, err := f.meter.Int64Gauge(f.subScope(name))
+	if err != nil {
+		otel.Handle(err)
+	}
+	if g == nil {
+		return NullGauge
+	}
+	return &otelGauge{gauge: g, attributes: f.attributes(tags)}
+}
+
+// Timer implements Timer of metrics.Factory.
+func (f *OTelFactory) Timer(name string, tags map[string]string) Timer {
+	opts := []otelmetric.Float64HistogramOption{otelmetric.WithUnit("s")}
+	if f.buckets != nil {
+		opts = append(opts, otelmetric.WithExplicitBucketBoundaries(f.buckets...))
+	}
+	h, err := f.meter.Float64Histogram(f.subScope(name), opts...)
+	if err != nil {
+		otel.Handle(err)
+	}
+	if h == nil {
+		return NullTimer
+	}
+	return &otelTimer{histogram: h, attributes: f.attributes(tags)}
+}
+
+// Histogram implements Histogram of metrics.Factory.
+// If buckets is nil, the factory default buckets are used.
+func (f *OTelFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	if buckets == nil {
+		buckets = f.buckets
+	}
+	var opts []otelmetric.Float64HistogramOption
+	if buckets != nil {
+		opts = append(opts, otelmetric.WithExplicitBucketBoundaries(buckets...))
+	}
+	h, err := f.meter.Float64Histogram(f.subScope(name), opts...)
+	if err != nil {
+		otel.Handle(err)
+	}
+	if h == nil {
+		return NullHistogram
+	}
+	return &otelHistogram{histogram: h, attributes: f.attributes(tags)}
+}
+
+// Namespace implements Namespace of metrics.Factory.
+func (f *OTelFactory) Namespace(name string, tags map[string]string) Factory {
+	return &OTelFactory{
+		meter:   f.meter,
+		scope:   f.subScope(name),
+		tags:    f.mergeTags(tags),
+		buckets: f.buckets,
+	}
+}
+
+func (f *OTelFactory) subScope(name string) string {
+	if f.scope == "" {
+		return name
+	}
+	if name == "" {
+		return f.scope
+	}
+	return f.scope + "." + name
+}
+
+func (f *OTelFactory) mergeTags(tags map[string]string) map[string]string {
+	ret := make(map[string]string, len(f.tags)+len(tags))
+	for k, v := range f.tags {
+		ret[k] = v
+	}
+	for k, v := range tags {
+		ret[k] = v
+	}
+	return ret
+}
+
+func (f *OTelFactory) attributes(tags map[string]string) otelmetric.MeasurementOption {
+	tags = f.mergeTags(tags)
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]attribute.KeyValue, 0, len(tags))
+	for _, k := range keys {
+		kvs = append(kvs, attribute.String(k, tags[k]))
+	}
+	return otelmetric.WithAttributeSet(attribute.NewSet(kvs...))
+}
+
+type otelCounter struct {
+	counter    otelmetric.Int64Counter
+	attributes otelmetric.MeasurementOption
+}
+
+func (c *otelCounter) Inc(v int64) {
+	c.counter.Add(context.Background(), v, c.attributes)
+}
+
+type otelGauge struct {
+	gauge      otelmetric.Int64Gauge
+	attributes otelmetric.MeasurementOption
+}
+
+func (g *otelGauge) Update(v int64) {
+	g.gauge.Record(context.Background(), v, g.attributes)
+}
+
+type otelTimer struct {
+	histogram  otelmetric.Float64Histogram
+	attributes otelmetric.MeasurementOption
+}
+
+func (t *otelTimer) Record(v time.Duration) {
+	t.RecordContext(context.Background(), v)
+}
+
+// RecordContext records v with ctx, which lets the SDK sample exemplars of the span in ctx.
+func (t *otelTimer) RecordContext(ctx context.Context, v time.Duration) {
+	t.histogram.Record(ctx, v.Seconds(), t.attributes)
+}
+
+type otelHistogram struct {
+	histogram  otelmetric.Float64Histogram
+	attributes otelmetric.MeasurementOption
+}
+
+func (h *otelHistogram) Record(v float64) {
+	h.RecordContext(context.Background(), v)
+}
+
+// RecordContext records v with ctx, which lets the SDK sample exemplars of the span in ctx.
+func (h *otelHistogram) RecordContext(ctx context.Context, v float64) {
+	h.histogram.Record(ctx, v, h.attributes)
+}
+
+// OTLPConfig configures the OTLP/HTTP exporter of NewOTLPMeterProvider.
+type OTLPConfig struct {
+	// Endpoint is the host and port of the collector, e.g. "localhost:4318".
+	Endpoint string
+	// URLPath defaults to "/v1/metrics".
+	URLPath string
+	// Insecure selects http instead of https.
+	Insecure bool
+	// Headers are sent with every export, e.g. for authentication.
+	Headers map[string]string
+	// Timeout of every export, defaults to 10 seconds.
+	Timeout time.Duration
+	// Interval between exports, defaults to 1 minute.
+	Interval time.Duration
+	// ServiceName is set as the service.name resource attribute.
+	ServiceName string
+}
+
+// NewOTLPMeterProvider creates a MeterProvider that periodically exports its metrics to
+// an OTLP/HTTP collector. Shutdown the provider to export the last metrics before exit.
+func NewOTLPMeterProvider(ctx context.Context, cfg OTLPConfig) (*sdkmetric.MeterProvider, error) {
+	opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.URLPath != "" {
+		opts = append(opts, otlpmetrichttp.WithURLPath(cfg.URLPath))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, otlpmetrichttp.WithTimeout(cfg.Timeout))
+	}
+	exporter, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var readerOpts []sdkmetric.PeriodicReaderOption
+	if cfg.Interval > 0 {
+		readerOpts = append(readerOpts, sdkmetric.WithInterval(cfg.Interval))
+	}
+	res := resource.Default()
+	if cfg.ServiceName != "" {
+		res, err = resource.Merge(res, resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, readerOpts...)),
+		sdkmetric.WithResource(res),
+	), nil
+}
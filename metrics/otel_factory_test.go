@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ Factory = new(OTelFactory)
+
+func collectOTel(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	ret := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		assert.Equal(t, defaultOTelInstrumentationName, sm.Scope.Name)
+		for _, m := range sm.Metrics {
+			ret[m.Name] = m
+		}
+	}
+	return ret
+}
+
+func TestOTelFactory(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	f := NewOTelFactory(provider, WithOTelBuckets([]float64{0.5, 1}))
+	ns := f.Namespace("http", map[string]string{"a": "b"})
+	ns.Counter("requests", map[string]string{"code": "200"}).Inc(3)
+	ns.Counter("requests", map[string]string{"code": "200"}).Inc(2)
+	ns.Gauge("in_flight", nil).Update(4)
+	ns.Timer("latency", nil).Record(750 * time.Millisecond)
+	ns.Namespace("", nil).Histogram("size", nil, []float64{10, 100}).Record(42)
+
+	collected := collectOTel(t, reader)
+	expectedAttributes := attribute.NewSet(attribute.String("a", "b"))
+
+	requests := collected["http.requests"].Data.(metricdata.Sum[int64])
+	assert.True(t, requests.IsMonotonic)
+	require.Len(t, requests.DataPoints, 1)
+	assert.EqualValues(t, 5, requests.DataPoints[0].Value)
+	assert.Equal(t, attribute.NewSet(attribute.String("a", "b"), attribute.String("code", "200")),
+		requests.DataPoints[0].Attributes)
+
+	inFlight := collected["http.in_flight"].Data.(metricdata.Gauge[int64])
+	require.Len(t, inFlight.DataPoints, 1)
+	assert.EqualValues(t, 4, inFlight.DataPoints[0].Value)
+	assert.Equal(t, expectedAttributes, inFlight.DataPoints[0].Attributes)
+
+	assert.Equal(t, "s", collected["http.latency"].Unit)
+	latency := collected["http.latency"].Data.(metricdata.Histogram[float64])
+	require.Len(t, latency.DataPoints, 1)
+	assert.Equal(t, []float64{0.5, 1}, latency.DataPoints[0].Bounds)
+	assert.Equal(t, []uint64{0, 1, 0}, latency.DataPoints[0].BucketCounts)
+	assert.Equal(t, 0.75, latency.DataPoints[0].Sum)
+
+	size := collected["http.size"].Data.(metricdata.Histogram[float64])
+	require.Len(t, size.DataPoints, 1)
+	assert.Equal(t, []float64{10, 100}, size.DataPoints[0].Bounds)
+	assert.Equal(t, []uint64{0, 1, 0}, size.DataPoints[0].BucketCounts)
+}
+
+func TestOTLPMeterProvider(t *testing.T) {
+	var lock sync.Mutex
+	var requests []*collectormetrics.ExportMetricsServiceRequest
+	var headers []http.Header
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := &collectormetrics.ExportMetricsServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, req))
+		lock.Lock()
+		requests = append(requests, req)
+		headers = append(headers, r.Header)
+		lock.Unlock()
+		assert.Equal(t, "/custom/metrics", r.URL.Path)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		out, _ := proto.Marshal(&collectormetrics.ExportMetricsServiceResponse{})
+		w.Write(out)
+	}))
+	defer collector.Close()
+
+	provider, err := NewOTLPMeterProvider(context.Background(), OTLPConfig{
+		Endpoint:    strings.TrimPrefix(collector.URL, "http://"),
+		URLPath:     "/custom/metrics",
+		Insecure:    true,
+		Headers:     map[string]string{"authorization": "token"},
+		Interval:    time.Hour,
+		ServiceName: "orders",
+	})
+	require.NoError(t, err)
+	NewOTelFactory(provider).Counter("processed", nil).Inc(7)
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "token", headers[0].Get("authorization"))
+	rm := requests[0].GetResourceMetrics()[0]
+	var serviceName string
+	for _, kv := range rm.GetResource().GetAttributes() {
+		if kv.GetKey() == "service.name" {
+			serviceName = kv.GetValue().GetStringValue()
+		}
+	}
+	assert.Equal(t, "orders", serviceName)
+	m := rm.GetScopeMetrics()[0].GetMetrics()[0]
+	assert.Equal(t, "processed", m.GetName())
+	assert.EqualValues(t, 7, m.GetSum().GetDataPoints()[0].GetAsInt())
+}
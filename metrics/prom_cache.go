@@ -15,26 +15,44 @@
 package metrics
 
 import (
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// overflowLabelValue replaces every label value of the series created after a
+// metric reached its cardinality limit.
+const overflowLabelValue = "__overflow__"
+
 type vectorCache struct {
 	registerer prometheus.Registerer
 	lock       sync.Mutex
 	cVecs      map[string]*prometheus.CounterVec
 	gVecs      map[string]*prometheus.GaugeVec
 	hVecs      map[string]*prometheus.HistogramVec
+	hBuckets   map[string][]float64
+
+	// cardinality limits, zero means unlimited
+	limit  int
+	limits map[string]int
+	series map[string]map[string]struct{}
+	// overflow counts the updates collapsed into the overflow series, the overflowed
+	// series themselves are not kept so that memory stays bounded by the limits
+	overflow *prometheus.CounterVec
 }
 
-func newVectorCache(registerer prometheus.Registerer) *vectorCache {
+func newVectorCache(registerer prometheus.Registerer, limit int, limits map[string]int) *vectorCache {
 	return &vectorCache{
 		registerer: registerer,
 		cVecs:      make(map[string]*prometheus.CounterVec),
 		gVecs:      make(map[string]*prometheus.GaugeVec),
 		hVecs:      make(map[string]*prometheus.HistogramVec),
+		hBuckets:   make(map[string][]float64),
+		limit:      limit,
+		limits:     limits,
+		series:     make(map[string]map[string]struct{}),
 	}
 }
 
@@ -66,7 +84,9 @@ func (c *vectorCache) getOrMakeGaugeVec(opts prometheus.GaugeOpts, labelNames []
 	return gv
 }
 
-func (c *vectorCache) getOrMakeHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *prometheus.HistogramVec {
+// getOrMakeHistogramVec also returns the buckets of the vector, which are the buckets of
+// the first call for the same name and labels.
+func (c *vectorCache) getOrMakeHistogramVec(opts prometheus.HistogramOpts, labelNames []string) (*prometheus.HistogramVec, []float64) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
@@ -76,10 +96,83 @@ func (c *vectorCache) getOrMakeHistogramVec(opts prometheus.HistogramOpts, label
 		hv = prometheus.NewHistogramVec(opts, labelNames)
 		c.registerer.MustRegister(hv)
 		c.hVecs[cacheKey] = hv
+		if opts.Buckets == nil {
+			opts.Buckets = prometheus.DefBuckets
+		}
+		c.hBuckets[cacheKey] = opts.Buckets
+	}
+	return hv, c.hBuckets[cacheKey]
+}
+
+// limitLabelValues returns the label values to use for a series of the named metric.
+// Once the metric holds as many distinct series as its cardinality limit, new series
+// collapse into a single one with every label set to overflowLabelValue, and the
+// overflow self-metric is incremented on every update of the collapsed series.
+func (c *vectorCache) limitLabelValues(name string, labelNames, labelValues []string) []string {
+	limit, ok := c.limits[name]
+	if !ok {
+		limit = c.limit
+	}
+	if limit <= 0 || len(labelNames) == 0 {
+		return labelValues
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cacheKey := c.getCacheKey(name, labelNames)
+	seriesKey := seriesKey(labelValues)
+	series, ok := c.series[cacheKey]
+	if !ok {
+		series = make(map[string]struct{})
+		c.series[cacheKey] = series
 	}
-	return hv
+	if _, ok := series[seriesKey]; ok || len(series) < limit {
+		series[seriesKey] = struct{}{}
+		return labelValues
+	}
+
+	c.getOrMakeOverflowCounter().WithLabelValues(name).Inc()
+	overflow := make([]string, len(labelValues))
+	for i := range overflow {
+		overflow[i] = overflowLabelValue
+	}
+	return overflow
+}
+
+// getOrMakeOverflowCounter must be called with the lock held. The counter is shared
+// with other factories using the same registerer.
+func (c *vectorCache) getOrMakeOverflowCounter() *prometheus.CounterVec {
+	if c.overflow != nil {
+		return c.overflow
+	}
+	cv := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "metrics_cardinality_overflow_total",
+		Help: "Number of updates collapsed into the " + overflowLabelValue + " series because the metric reached its cardinality limit",
+	}, []string{"metric"})
+	if err := c.registerer.Register(cv); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		cv = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+	c.overflow = cv
+	return cv
 }
 
 func (c *vectorCache) getCacheKey(name string, labels []string) string {
 	return strings.Join(append([]string{name}, labels...), "||")
 }
+
+// seriesKey identifies the label values of a series. Every value is prefixed by its length,
+// so that values containing a separator cannot collide.
+func seriesKey(labelValues []string) string {
+	var b strings.Builder
+	for _, v := range labelValues {
+		b.WriteString(strconv.Itoa(len(v)))
+		b.WriteByte(':')
+		b.WriteString(v)
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	promModel "github.com/prometheus/client_model/go"
+
+	"github.com/liornabat/golibs/logging"
+)
+
+// OpenMetricsContentType is the content type of the OpenMetrics text format served with exemplars.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+var handlerLogger = logging.NewLogger("metrics/prometheus")
+
+// exemplar links an observation of a histogram bucket to the trace it was recorded in.
+type exemplar struct {
+	traceID   string
+	value     float64
+	timestamp time.Time
+}
+
+// exemplarStore keeps the latest exemplar of every bucket of every timer and histogram
+// series of a PrometheusFactory.
+type exemplarStore struct {
+	lock    sync.Mutex
+	series  map[string][]*exemplar
+	traceID func(ctx context.Context) (string, bool)
+	timeNow func() time.Time
+}
+
+func newExemplarStore(traceID func(ctx context.Context) (string, bool)) *exemplarStore {
+	return &exemplarStore{
+		series:  make(map[string][]*exemplar),
+		traceID: traceID,
+		timeNow: time.Now,
+	}
+}
+
+// exemplarKey identifies a series by metric name and label values, ordered by label name
+// as they are both in the factory and in gathered metrics.
+func exemplarKey(name string, labelValues []string) string {
+	return name + "\xff" + strings.Join(labelValues, "\xff")
+}
+
+func (s *exemplarStore) record(ctx context.Context, key string, buckets []float64, value float64) {
+	if s.traceID == nil || ctx == nil {
+		return
+	}
+	traceID, ok := s.traceID(ctx)
+	if !ok {
+		return
+	}
+	bucket := sort.SearchFloat64s(buckets, value)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	exemplars, ok := s.series[key]
+	if !ok {
+		// the extra bucket is +Inf
+		exemplars = make([]*exemplar, len(buckets)+1)
+		s.series[key] = exemplars
+	}
+	exemplars[bucket] = &exemplar{traceID: traceID, value: value, timestamp: s.timeNow()}
+}
+
+func (s *exemplarStore) get(key string) []*exemplar {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*exemplar(nil), s.series[key]...)
+}
+
+// Handler returns an http.Handler serving the metrics of the factory registry.
+// Scrapers that accept OpenMetrics also get the exemplars of the timers and histograms, see
+// WithTraceIDFromContext, e.g. to jump from a latency spike to a trace.
+func (f *PrometheusFactory) Handler() http.Handler {
+	text := promhttp.HandlerFor(f.gatherer, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			text.ServeHTTP(w, r)
+			return
+		}
+		families, err := f.gatherer.Gather()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+		if err := writeOpenMetrics(w, families, f.exemplars); err != nil {
+			handlerLogger.Error(fmt.Errorf("unable to write metrics: %w", err))
+		}
+	})
+}
+
+// writeOpenMetrics writes the families in the OpenMetrics text format, with the exemplars
+// of histogram buckets.
+func writeOpenMetrics(w io.Writer, families []*promModel.MetricFamily, exemplars *exemplarStore) error {
+	var buf bytes.Buffer
+	for _, family := range families {
+		name := family.GetName()
+		typ := "unknown"
+		switch family.GetType() {
+		case promModel.MetricType_COUNTER:
+			typ = "counter"
+			name = strings.TrimSuffix(name, "_total")
+		case promModel.MetricType_GAUGE:
+			typ = "gauge"
+		case promModel.MetricType_HISTOGRAM:
+			typ = "histogram"
+		case promModel.MetricType_SUMMARY:
+			typ = "summary"
+		}
+		buf.WriteString("# HELP " + name + " " + labelValueEscaper.Replace(family.GetHelp()) + "\n")
+		buf.WriteString("# TYPE " + name + " " + typ + "\n")
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string, len(m.GetLabel()))
+			labelValues := make([]string, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+				labelValues = append(labelValues, l.GetValue())
+			}
+			switch family.GetType() {
+			case promModel.MetricType_COUNTER:
+				writeOpenMetricsSample(&buf, name+"_total", labels, m.GetCounter().GetValue(), nil)
+			case promModel.MetricType_GAUGE:
+				writeOpenMetricsSample(&buf, name, labels, m.GetGauge().GetValue(), nil)
+			case promModel.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				series := exemplars.get(exemplarKey(family.GetName(), labelValues))
+				buckets := h.GetBucket()
+				for i, b := range buckets {
+					writeOpenMetricsSample(&buf, name+"_bucket", withLabel(labels, "le", formatFloat(b.GetUpperBound())),
+						float64(b.GetCumulativeCount()), exemplarAt(series, i))
+				}
+				if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].GetUpperBound(), 1) {
+					writeOpenMetricsSample(&buf, name+"_bucket", withLabel(labels, "le", "+Inf"),
+						float64(h.GetSampleCount()), exemplarAt(series, len(buckets)))
+				}
+				writeOpenMetricsSample(&buf, name+"_sum", labels, h.GetSampleSum(), nil)
+				writeOpenMetricsSample(&buf, name+"_count", labels, float64(h.GetSampleCount()), nil)
+			case promModel.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					writeOpenMetricsSample(&buf, name, withLabel(labels, "quantile", formatFloat(q.GetQuantile())),
+						q.GetValue(), nil)
+				}
+				writeOpenMetricsSample(&buf, name+"_sum", labels, s.GetSampleSum(), nil)
+				writeOpenMetricsSample(&buf, name+"_count", labels, float64(s.GetSampleCount()), nil)
+			default:
+				writeOpenMetricsSample(&buf, name, labels, m.GetUntyped().GetValue(), nil)
+			}
+		}
+	}
+	buf.WriteString("# EOF\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func exemplarAt(series []*exemplar, i int) *exemplar {
+	if i < len(series) {
+		return series[i]
+	}
+	return nil
+}
+
+func writeOpenMetricsSample(buf *bytes.Buffer, name string, labels map[string]string, value float64, e *exemplar) {
+	buf.WriteString(name)
+	writeLabels(buf, labels)
+	buf.WriteString(" " + formatFloat(value))
+	if e != nil {
+		buf.WriteString(" # ")
+		writeLabels(buf, map[string]string{"trace_id": e.traceID})
+		buf.WriteString(" " + formatFloat(e.value))
+		buf.WriteString(" " + strconv.FormatFloat(float64(e.timestamp.UnixNano())/1e9, 'f', 3, 64))
+	}
+	buf.WriteByte('\n')
+}
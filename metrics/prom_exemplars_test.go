@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	zipkin "github.com/openzipkin/zipkin-go-opentracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tracedContext(t *testing.T) (context.Context, string) {
+	tracer, err := zipkin.NewTracer(zipkin.NewRecorder(zipkin.NopCollector{}, false, "localhost:0", "test"),
+		zipkin.TraceID128Bit(false))
+	require.NoError(t, err)
+	span := tracer.StartSpan("operation")
+	defer span.Finish()
+	return opentracing.ContextWithSpan(context.Background(), span), span.Context().(zipkin.SpanContext).TraceID.ToHex()
+}
+
+// zipkinTraceID returns the trace ID of the zipkin span of ctx, like tracing.TraceIDFromContext.
+func zipkinTraceID(ctx context.Context) (string, bool) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", false
+	}
+	return span.Context().(zipkin.SpanContext).TraceID.ToHex(), true
+}
+
+func scrape(t *testing.T, h http.Handler, accept string) (string, string) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, err := ioutil.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return rec.Header().Get("Content-Type"), string(body)
+}
+
+func TestExemplars(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	f := New(WithRegisterer(registry), WithBuckets([]float64{0.1, 1}), WithTraceIDFromContext(zipkinTraceID))
+	f.exemplars.timeNow = func() time.Time { return time.Unix(1500000000, 0) }
+	ctx, traceID := tracedContext(t)
+
+	ns := f.Namespace("http", map[string]string{"a": "b"})
+	RecordTimer(ctx, ns.Timer("latency", nil), 500*time.Millisecond)
+	RecordTimer(context.Background(), ns.Timer("latency", nil), 50*time.Millisecond)
+	RecordHistogram(ctx, ns.Histogram("size", nil, []float64{10}), 42)
+	ns.Counter("requests", nil).Inc(2)
+	ns.Gauge("in_flight", nil).Update(1)
+
+	contentType, body := scrape(t, f.Handler(), "application/openmetrics-text; version=1.0.0")
+	assert.Equal(t, OpenMetricsContentType, contentType)
+	assert.Equal(t, `# HELP http:in_flight http:in_flight
+# TYPE http:in_flight gauge
+http:in_flight{a="b"} 1
+# HELP http:latency http:latency
+# TYPE http:latency histogram
+http:latency_bucket{a="b",le="0.1"} 1
+http:latency_bucket{a="b",le="1"} 2 # {trace_id="`+traceID+`"} 0.5 1500000000.000
+http:latency_bucket{a="b",le="+Inf"} 2
+http:latency_sum{a="b"} 0.55
+http:latency_count{a="b"} 2
+# HELP http:requests http:requests
+# TYPE http:requests counter
+http:requests_total{a="b"} 2
+# HELP http:size http:size
+# TYPE http:size histogram
+http:size_bucket{a="b",le="10"} 0
+http:size_bucket{a="b",le="+Inf"} 1 # {trace_id="`+traceID+`"} 42 1500000000.000
+http:size_sum{a="b"} 42
+http:size_count{a="b"} 1
+# EOF
+`, body)
+
+	_, body = scrape(t, f.Handler(), "text/plain")
+	assert.Contains(t, body, `http:latency_bucket{a="b",le="1"} 2`+"\n")
+	assert.NotContains(t, body, "trace_id")
+
+	f = New(WithRegisterer(prometheus.NewPedanticRegistry()))
+	RecordTimer(ctx, f.Timer("latency", nil), time.Second)
+	_, body = scrape(t, f.Handler(), "application/openmetrics-text; version=1.0.0")
+	assert.NotContains(t, body, "trace_id", "no trace ID lookup")
+}
+
+func TestRecordWithoutContextSupport(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	ctx, _ := tracedContext(t)
+
+	RecordTimer(ctx, f.Timer("latency", nil), time.Millisecond)
+	RecordHistogram(ctx, f.Histogram("size", nil, []float64{1}), 1)
+	tee := NewTeeFactory(f)
+	RecordTimer(ctx, tee.Timer("latency", nil), time.Millisecond)
+	RecordHistogram(ctx, tee.Histogram("size", nil, []float64{1}), 1)
+
+	s := f.SnapshotDetailed()
+	assert.EqualValues(t, 2, s.Timers["latency"].Count)
+	assert.EqualValues(t, 2, s.Histograms["size"].Count)
+}
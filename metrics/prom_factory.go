@@ -15,6 +15,7 @@
 package metrics
 
 import (
+	"context"
 	"sort"
 	"strings"
 	"time"
@@ -30,11 +31,16 @@ type PrometheusFactory struct {
 	cache      *vectorCache
 	buckets    []float64
 	normalizer *strings.Replacer
+	gatherer   prometheus.Gatherer
+	exemplars  *exemplarStore
 }
 
 type options struct {
 	registerer prometheus.Registerer
 	buckets    []float64
+	limit      int
+	limits     map[string]int
+	traceID    func(ctx context.Context) (string, bool)
 }
 
 // Option is a function that sets some option for the PrometheusFactory constructor.
@@ -56,6 +62,35 @@ func WithBuckets(buckets []float64) Option {
 	}
 }
 
+// WithCardinalityLimit returns an option that limits the number of label combinations of
+// every metric. Series created after the limit is reached collapse into a single series
+// with every label set to "__overflow__". If not used, metrics are unlimited.
+func WithCardinalityLimit(limit int) Option {
+	return func(opts *options) {
+		opts.limit = limit
+	}
+}
+
+// WithTraceIDFromContext returns an option that attaches the trace ID returned by traceID
+// as exemplar to the timers and histograms recorded with RecordTimer and RecordHistogram,
+// e.g. WithTraceIDFromContext(tracing.TraceIDFromContext). If not used, there are no exemplars.
+func WithTraceIDFromContext(traceID func(ctx context.Context) (string, bool)) Option {
+	return func(opts *options) {
+		opts.traceID = traceID
+	}
+}
+
+// WithMetricCardinalityLimit returns an option that overrides the cardinality limit of the
+// metric with the given full name, e.g. "http:requests" for Namespace("http").Counter("requests").
+func WithMetricCardinalityLimit(name string, limit int) Option {
+	return func(opts *options) {
+		if opts.limits == nil {
+			opts.limits = make(map[string]int)
+		}
+		opts.limits[name] = limit
+	}
+}
+
 func applyOptions(opts []Option) *options {
 	options := new(options)
 	for _, o := range opts {
@@ -77,11 +112,17 @@ func applyOptions(opts []Option) *options {
 // implicitly. The default value is prometheus.DefBuckets.
 func New(opts ...Option) *PrometheusFactory {
 	options := applyOptions(opts)
+	gatherer, ok := options.registerer.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
 	return newFactory(
 		&PrometheusFactory{// dummy struct to be discarded
-			cache:      newVectorCache(options.registerer),
+			cache:      newVectorCache(options.registerer, options.limit, options.limits),
 			buckets:    options.buckets,
 			normalizer: strings.NewReplacer(".", "_", "-", "_"),
+			gatherer:   gatherer,
+			exemplars:  newExemplarStore(options.traceID),
 		},
 		"",  // scope
 		nil) // tags
@@ -92,6 +133,8 @@ func newFactory(parent *PrometheusFactory, scope string, tags map[string]string)
 		cache:      parent.cache,
 		buckets:    parent.buckets,
 		normalizer: parent.normalizer,
+		gatherer:   parent.gatherer,
+		exemplars:  parent.exemplars,
 		scope:      scope,
 		tags:       tags,
 	}
@@ -99,47 +142,93 @@ func newFactory(parent *PrometheusFactory, scope string, tags map[string]string)
 
 // Counter implements Counter of metrics.PrometheusFactory.
 func (f *PrometheusFactory) Counter(name string, tags map[string]string) Counter {
-	name = f.subScope(name)
-	tags = f.mergeTags(tags)
+	return f.CounterWithOptions(MetricOptions{Name: name, Tags: tags})
+}
+
+// CounterWithOptions implements CounterWithOptions of metrics.OptionsFactory.
+func (f *PrometheusFactory) CounterWithOptions(o MetricOptions) Counter {
+	name := f.subScope(o.Name)
+	tags := f.mergeTags(o.Tags)
 	labelNames := f.tagNames(tags)
 	opts := prometheus.CounterOpts{
 		Name: name,
-		Help: name,
+		Help: helpOrName(o.Help, name),
 	}
 	cv := f.cache.getOrMakeCounterVec(opts, labelNames)
 	return &counter{
-		counter: cv.WithLabelValues(f.tagsAsLabelValues(labelNames, tags)...),
+		counter: cv.WithLabelValues(f.labelValues(name, labelNames, tags)...),
 	}
 }
 
 // Gauge implements Gauge of metrics.PrometheusFactory.
 func (f *PrometheusFactory) Gauge(name string, tags map[string]string) Gauge {
-	name = f.subScope(name)
-	tags = f.mergeTags(tags)
+	return f.GaugeWithOptions(MetricOptions{Name: name, Tags: tags})
+}
+
+// GaugeWithOptions implements GaugeWithOptions of metrics.OptionsFactory.
+func (f *PrometheusFactory) GaugeWithOptions(o MetricOptions) Gauge {
+	name := f.subScope(o.Name)
+	tags := f.mergeTags(o.Tags)
 	labelNames := f.tagNames(tags)
 	opts := prometheus.GaugeOpts{
 		Name: name,
-		Help: name,
+		Help: helpOrName(o.Help, name),
 	}
 	gv := f.cache.getOrMakeGaugeVec(opts, labelNames)
 	return &gauge{
-		gauge: gv.WithLabelValues(f.tagsAsLabelValues(labelNames, tags)...),
+		gauge: gv.WithLabelValues(f.labelValues(name, labelNames, tags)...),
 	}
 }
 
 // Timer implements Timer of metrics.PrometheusFactory.
 func (f *PrometheusFactory) Timer(name string, tags map[string]string) Timer {
-	name = f.subScope(name)
-	tags = f.mergeTags(tags)
+	return f.TimerWithOptions(MetricOptions{Name: name, Tags: tags})
+}
+
+// TimerWithOptions implements TimerWithOptions of metrics.OptionsFactory.
+// Buckets are in seconds, if nil the factory default buckets are used.
+func (f *PrometheusFactory) TimerWithOptions(o MetricOptions) Timer {
+	name := f.subScope(o.Name)
+	tags := f.mergeTags(o.Tags)
 	labelNames := f.tagNames(tags)
 	opts := prometheus.HistogramOpts{
 		Name:    name,
-		Help:    name,
-		Buckets: f.buckets,
+		Help:    helpOrName(o.Help, name),
+		Buckets: f.bucketsOrDefault(o.Buckets),
 	}
-	hv := f.cache.getOrMakeHistogramVec(opts, labelNames)
+	hv, buckets := f.cache.getOrMakeHistogramVec(opts, labelNames)
+	labelValues := f.labelValues(name, labelNames, tags)
 	return &timer{
-		histogram: hv.WithLabelValues(f.tagsAsLabelValues(labelNames, tags)...),
+		histogram: hv.WithLabelValues(labelValues...),
+		exemplars: f.exemplars,
+		key:       exemplarKey(name, labelValues),
+		buckets:   buckets,
+	}
+}
+
+// Histogram implements Histogram of metrics.PrometheusFactory.
+// If buckets is nil, the factory default buckets are used.
+func (f *PrometheusFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	return f.HistogramWithOptions(MetricOptions{Name: name, Tags: tags, Buckets: buckets})
+}
+
+// HistogramWithOptions implements HistogramWithOptions of metrics.OptionsFactory.
+func (f *PrometheusFactory) HistogramWithOptions(o MetricOptions) Histogram {
+	name := f.subScope(o.Name)
+	tags := f.mergeTags(o.Tags)
+	labelNames := f.tagNames(tags)
+	opts := prometheus.HistogramOpts{
+		Name:    name,
+		Help:    helpOrName(o.Help, name),
+		Buckets: f.bucketsOrDefault(o.Buckets),
+	}
+	hv, buckets := f.cache.getOrMakeHistogramVec(opts, labelNames)
+	labelValues := f.labelValues(name, labelNames, tags)
+	return &histogram{
+		histogram: hv.WithLabelValues(labelValues...),
+		exemplars: f.exemplars,
+		key:       exemplarKey(name, labelValues),
+		buckets:   buckets,
 	}
 }
 
@@ -166,12 +255,39 @@ func (g *gauge) Update(v int64) {
 
 type timer struct {
 	histogram prometheus.Observer
+	exemplars *exemplarStore
+	key       string
+	buckets   []float64
 }
 
 func (t *timer) Record(v time.Duration) {
 	t.histogram.Observe(float64(v.Nanoseconds()) / float64(time.Second/time.Nanosecond))
 }
 
+// RecordContext records v and keeps the trace ID of the span in ctx as exemplar of its bucket.
+func (t *timer) RecordContext(ctx context.Context, v time.Duration) {
+	seconds := float64(v.Nanoseconds()) / float64(time.Second/time.Nanosecond)
+	t.histogram.Observe(seconds)
+	t.exemplars.record(ctx, t.key, t.buckets, seconds)
+}
+
+type histogram struct {
+	histogram prometheus.Observer
+	exemplars *exemplarStore
+	key       string
+	buckets   []float64
+}
+
+func (h *histogram) Record(v float64) {
+	h.histogram.Observe(v)
+}
+
+// RecordContext records v and keeps the trace ID of the span in ctx as exemplar of its bucket.
+func (h *histogram) RecordContext(ctx context.Context, v float64) {
+	h.histogram.Observe(v)
+	h.exemplars.record(ctx, h.key, h.buckets, v)
+}
+
 func (f *PrometheusFactory) subScope(name string) string {
 	if f.scope == "" {
 		return f.normalize(name)
@@ -182,6 +298,20 @@ func (f *PrometheusFactory) subScope(name string) string {
 	return f.normalize(f.scope + ":" + name)
 }
 
+func (f *PrometheusFactory) bucketsOrDefault(buckets []float64) []float64 {
+	if buckets == nil {
+		return f.buckets
+	}
+	return buckets
+}
+
+func helpOrName(help, name string) string {
+	if help == "" {
+		return name
+	}
+	return help
+}
+
 func (f *PrometheusFactory) normalize(v string) string {
 	return f.normalizer.Replace(v)
 }
@@ -206,6 +336,10 @@ func (f *PrometheusFactory) tagNames(tags map[string]string) []string {
 	return ret
 }
 
+func (f *PrometheusFactory) labelValues(name string, labelNames []string, tags map[string]string) []string {
+	return f.cache.limitLabelValues(name, labelNames, f.tagsAsLabelValues(labelNames, tags))
+}
+
 func (f *PrometheusFactory) tagsAsLabelValues(labels []string, tags map[string]string) []string {
 	ret := make([]string, 0, len(tags))
 	for _, l := range labels {
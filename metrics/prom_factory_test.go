@@ -22,12 +22,9 @@ import (
 	promModel "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-
-	"github.com/uber/jaeger-lib/metrics"
-	. "github.com/uber/jaeger-lib/metrics/prometheus"
 )
 
-var _ metrics.Factory = new(Factory)
+var _ Factory = new(PrometheusFactory)
 
 func TestOptions(t *testing.T) {
 	f1 := New()
@@ -142,6 +139,147 @@ func TestTimerCustomBuckets(t *testing.T) {
 	assert.Len(t, m1.GetHistogram().GetBucket(), 1)
 }
 
+func TestHistogram(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	f1 := New(WithRegisterer(registry), WithBuckets([]float64{1.5}))
+	f2 := f1.Namespace("bender", map[string]string{"a": "b"})
+	h1 := f2.Histogram("payload", map[string]string{"x": "y"}, []float64{10, 100, 1000})
+	h2 := f2.Histogram("batch", nil, nil)
+	h1.Record(5)
+	h1.Record(50)
+	h1.Record(5000)
+	h2.Record(1)
+
+	snapshot, err := registry.Gather()
+	require.NoError(t, err)
+
+	m1 := findMetric(t, snapshot, "bender:payload", map[string]string{"a": "b", "x": "y"})
+	assert.EqualValues(t, 3, m1.GetHistogram().GetSampleCount(), "%+v", m1)
+	assert.EqualValues(t, 5055, m1.GetHistogram().GetSampleSum(), "%+v", m1)
+	buckets := m1.GetHistogram().GetBucket()
+	require.Len(t, buckets, 3)
+	assert.EqualValues(t, 1, buckets[0].GetCumulativeCount())
+	assert.EqualValues(t, 2, buckets[1].GetCumulativeCount())
+	assert.EqualValues(t, 2, buckets[2].GetCumulativeCount())
+
+	m2 := findMetric(t, snapshot, "bender:batch", map[string]string{"a": "b"})
+	assert.Len(t, m2.GetHistogram().GetBucket(), 1)
+}
+
+func TestInitWithOptions(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	f := New(WithRegisterer(registry))
+	var m struct {
+		HTTP struct {
+			Requests Counter   `metric:"requests" help:"Number of requests"`
+			Latency  Timer     `metric:"latency" buckets:"0.1,1" help:"Request latency"`
+			Size     Histogram `metric:"size" buckets:"10"`
+		} `metric:"http"`
+	}
+	Init(&m, f, nil)
+	m.HTTP.Requests.Inc(1)
+	m.HTTP.Latency.Record(time.Second)
+	m.HTTP.Size.Record(1)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	help := make(map[string]string)
+	for _, family := range families {
+		help[family.GetName()] = family.GetHelp()
+	}
+	assert.Equal(t, map[string]string{
+		"http:requests": "Number of requests",
+		"http:latency":  "Request latency",
+		"http:size":     "http:size",
+	}, help)
+
+	latency := findMetric(t, families, "http:latency", nil)
+	assert.Len(t, latency.GetHistogram().GetBucket(), 2)
+	size := findMetric(t, families, "http:size", nil)
+	assert.Len(t, size.GetHistogram().GetBucket(), 1)
+}
+
+func TestInitWithOptionsCombinators(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	local := NewLocalFactory(0)
+	defer local.Stop()
+	f := NewNameFilterFactory(
+		NewPrefixFactory(
+			NewTagFilterFactory(
+				NewTeeFactory(New(WithRegisterer(registry)), local),
+				DropTags("user")),
+			"api_"),
+		nil, []string{"ignored"})
+	var m struct {
+		Requests Counter `metric:"requests" tags:"user=bender" help:"Number of requests"`
+		Latency  Timer   `metric:"latency" buckets:"0.1,1" help:"Request latency"`
+		Ignored  Counter `metric:"ignored" help:"Ignored"`
+	}
+	Init(&m, f, nil)
+	m.Requests.Inc(1)
+	m.Latency.Record(time.Second)
+	m.Ignored.Inc(1)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	help := make(map[string]string)
+	for _, family := range families {
+		help[family.GetName()] = family.GetHelp()
+	}
+	assert.Equal(t, map[string]string{
+		"api_requests": "Number of requests",
+		"api_latency":  "Request latency",
+	}, help)
+	latency := findMetric(t, families, "api_latency", nil)
+	assert.Len(t, latency.GetHistogram().GetBucket(), 2)
+
+	c, _ := local.Snapshot()
+	assert.Equal(t, map[string]int64{"api_requests": 1}, c)
+}
+
+func TestCardinalityLimit(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	f1 := New(WithRegisterer(registry), WithCardinalityLimit(2), WithMetricCardinalityLimit("bender:unlimited", 0))
+	f2 := f1.Namespace("bender", nil)
+	for _, user := range []string{"1", "2", "3", "4", "1", "3"} {
+		f2.Counter("requests", map[string]string{"user": user, "x": "y"}).Inc(1)
+		f2.Counter("unlimited", map[string]string{"user": user}).Inc(1)
+	}
+	f2.Gauge("untagged", nil).Update(1)
+
+	snapshot, err := registry.Gather()
+	require.NoError(t, err)
+
+	m1 := findMetric(t, snapshot, "bender:requests", map[string]string{"user": "1", "x": "y"})
+	assert.EqualValues(t, 2, m1.GetCounter().GetValue())
+	m2 := findMetric(t, snapshot, "bender:requests", map[string]string{"user": "2", "x": "y"})
+	assert.EqualValues(t, 1, m2.GetCounter().GetValue())
+	m3 := findMetric(t, snapshot, "bender:requests", map[string]string{"user": "__overflow__", "x": "__overflow__"})
+	assert.EqualValues(t, 3, m3.GetCounter().GetValue())
+	m4 := findMetric(t, snapshot, "bender:unlimited", map[string]string{"user": "4"})
+	assert.EqualValues(t, 1, m4.GetCounter().GetValue())
+	m5 := findMetric(t, snapshot, "metrics_cardinality_overflow_total", map[string]string{"metric": "bender:requests"})
+	assert.EqualValues(t, 3, m5.GetCounter().GetValue(), "every update of series 3 and 4 is counted")
+
+	// a second factory on the same registry shares the overflow counter
+	f3 := New(WithRegisterer(registry), WithCardinalityLimit(1))
+	f3.Gauge("other", map[string]string{"x": "1"}).Update(1)
+	f3.Gauge("other", map[string]string{"x": "2"}).Update(1)
+	snapshot, err = registry.Gather()
+	require.NoError(t, err)
+	m6 := findMetric(t, snapshot, "metrics_cardinality_overflow_total", map[string]string{"metric": "other"})
+	assert.EqualValues(t, 1, m6.GetCounter().GetValue())
+
+	// label values containing a separator are distinct series
+	f4 := New(WithRegisterer(registry), WithCardinalityLimit(1))
+	f4.Counter("joined", map[string]string{"a": "1||2", "b": "3"}).Inc(1)
+	f4.Counter("joined", map[string]string{"a": "1", "b": "2||3"}).Inc(1)
+	snapshot, err = registry.Gather()
+	require.NoError(t, err)
+	m7 := findMetric(t, snapshot, "joined", map[string]string{"a": "__overflow__", "b": "__overflow__"})
+	assert.EqualValues(t, 1, m7.GetCounter().GetValue())
+}
+
 func findMetric(t *testing.T, snapshot []*promModel.MetricFamily, name string, tags map[string]string) *promModel.Metric {
 	for _, mf := range snapshot {
 		if mf.GetName() != name {
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// PushExporter periodically pushes the metrics of a Prometheus registry to a
+// Pushgateway, for batch jobs that exit before they can be scraped.
+type PushExporter struct {
+	url      string
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	method   string
+	interval time.Duration
+	onError  func(error)
+
+	stopCh   chan struct{}
+	stopWG   sync.WaitGroup
+	stopOnce sync.Once
+}
+
+type pushOptions struct {
+	gatherer prometheus.Gatherer
+	grouping map[string]string
+	client   *http.Client
+	interval time.Duration
+	add      bool
+	onError  func(error)
+}
+
+// PushOption is a function that sets some option for the PushExporter constructor.
+type PushOption func(*pushOptions)
+
+// WithPushGatherer returns an option that sets the registry to push.
+// If not used we fallback to prometheus.DefaultGatherer, which is the registry used by
+// PrometheusFactory and instrument by default.
+func WithPushGatherer(gatherer prometheus.Gatherer) PushOption {
+	return func(opts *pushOptions) {
+		opts.gatherer = gatherer
+	}
+}
+
+// WithPushGrouping returns an option that sets the grouping labels added to the job label,
+// e.g. the instance name.
+func WithPushGrouping(grouping map[string]string) PushOption {
+	return func(opts *pushOptions) {
+		opts.grouping = grouping
+	}
+}
+
+// WithPushInterval returns an option that sets how often metrics are pushed.
+// If not used we fallback to 15 seconds.
+func WithPushInterval(interval time.Duration) PushOption {
+	return func(opts *pushOptions) {
+		opts.interval = interval
+	}
+}
+
+// WithPushHTTPClient returns an option that sets the http client used to push.
+func WithPushHTTPClient(client *http.Client) PushOption {
+	return func(opts *pushOptions) {
+		opts.client = client
+	}
+}
+
+// WithPushAdd returns an option that pushes with POST, which only replaces the metrics
+// with the same names, instead of PUT which replaces all the metrics of the group.
+func WithPushAdd() PushOption {
+	return func(opts *pushOptions) {
+		opts.add = true
+	}
+}
+
+// WithPushErrorHandler returns an option that sets a callback for errors of the periodic pushes.
+func WithPushErrorHandler(onError func(error)) PushOption {
+	return func(opts *pushOptions) {
+		opts.onError = onError
+	}
+}
+
+// NewPushExporter creates a PushExporter for the Pushgateway at gatewayURL, e.g.
+// "http://pushgateway:9091", grouping the metrics under the given job name.
+func NewPushExporter(gatewayURL, job string, opts ...PushOption) *PushExporter {
+	options := &pushOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+	if options.gatherer == nil {
+		options.gatherer = prometheus.DefaultGatherer
+	}
+	if options.client == nil {
+		options.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if options.interval <= 0 {
+		options.interval = 15 * time.Second
+	}
+	if options.onError == nil {
+		options.onError = func(error) {}
+	}
+	method := http.MethodPut
+	if options.add {
+		method = http.MethodPost
+	}
+	return &PushExporter{
+		url:      pushURL(gatewayURL, job, options.grouping),
+		gatherer: options.gatherer,
+		client:   options.client,
+		method:   method,
+		interval: options.interval,
+		onError:  options.onError,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func pushURL(gatewayURL, job string, grouping map[string]string) string {
+	if !strings.Contains(gatewayURL, "://") {
+		gatewayURL = "http://" + gatewayURL
+	}
+	u := strings.TrimSuffix(gatewayURL, "/") + "/metrics/" + pushPathComponent("job", job)
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		u += "/" + pushPathComponent(url.PathEscape(name), grouping[name])
+	}
+	return u
+}
+
+// pushPathComponent returns the name/value path of a grouping label. Values that cannot be
+// path segments, i.e. empty or containing "/", use the name@base64/value encoding of the
+// Pushgateway.
+func pushPathComponent(name, value string) string {
+	if value == "" {
+		return name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// Start starts a timer-based goroutine that pushes the metrics every interval.
+func (e *PushExporter) Start() {
+	ticker := time.NewTicker(e.interval)
+	e.stopWG.Add(1)
+	go func() {
+		defer e.stopWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.Push(); err != nil {
+					e.onError(err)
+				}
+			case <-e.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the periodic pushes and pushes the metrics a final time.
+func (e *PushExporter) Close() error {
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+	})
+	e.stopWG.Wait()
+	return e.Push()
+}
+
+// Push gathers the metrics and pushes them once.
+func (e *PushExporter) Push() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtProtoDelim)
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(e.method, e.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(expfmt.FmtProtoDelim))
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d while pushing to %s: %s", resp.StatusCode, e.url, body)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promModel "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pushRequest struct {
+	method   string
+	path     string
+	families map[string]*promModel.MetricFamily
+}
+
+type fakePushgateway struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []pushRequest
+	status   int
+}
+
+func newFakePushgateway(t *testing.T) *fakePushgateway {
+	g := &fakePushgateway{status: http.StatusAccepted}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families := make(map[string]*promModel.MetricFamily)
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			family := &promModel.MetricFamily{}
+			if err := dec.Decode(family); err != nil {
+				break
+			}
+			families[family.GetName()] = family
+		}
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		g.requests = append(g.requests, pushRequest{method: r.Method, path: r.URL.EscapedPath(), families: families})
+		w.WriteHeader(g.status)
+	}))
+	return g
+}
+
+func (g *fakePushgateway) received() []pushRequest {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return append([]pushRequest(nil), g.requests...)
+}
+
+func TestPushExporter(t *testing.T) {
+	gateway := newFakePushgateway(t)
+	defer gateway.Close()
+
+	registry := prometheus.NewPedanticRegistry()
+	f := New(WithRegisterer(registry))
+	f.Counter("processed", nil).Inc(7)
+
+	e := NewPushExporter(gateway.URL, "batch job", WithPushGatherer(registry),
+		WithPushGrouping(map[string]string{"instance": "host-1"}), WithPushInterval(time.Millisecond))
+	e.Start()
+	for i := 0; i < 1000 && len(gateway.received()) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	f.Counter("processed", nil).Inc(1)
+	require.NoError(t, e.Close())
+
+	requests := gateway.received()
+	require.True(t, len(requests) >= 2)
+	for _, r := range requests {
+		assert.Equal(t, http.MethodPut, r.method)
+		assert.Equal(t, "/metrics/job/batch%20job/instance/host-1", r.path)
+	}
+	last := requests[len(requests)-1].families["processed"]
+	require.NotNil(t, last)
+	assert.EqualValues(t, 8, last.GetMetric()[0].GetCounter().GetValue())
+
+	assert.NoError(t, e.Close(), "close is idempotent")
+}
+
+func TestPushExporterErrors(t *testing.T) {
+	gateway := newFakePushgateway(t)
+	defer gateway.Close()
+	gateway.status = http.StatusBadRequest
+
+	e := NewPushExporter(gateway.URL+"/", "job", WithPushGatherer(prometheus.NewRegistry()), WithPushAdd())
+	err := e.Push()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status code 400")
+	assert.Equal(t, http.MethodPost, gateway.received()[0].method)
+	assert.Equal(t, "/metrics/job/job", gateway.received()[0].path)
+}
+
+func TestPushURL(t *testing.T) {
+	assert.Equal(t, "http://gateway:9091/metrics/job/job/instance/host-1",
+		pushURL("gateway:9091/", "job", map[string]string{"instance": "host-1"}))
+	assert.Equal(t, "http://gateway:9091/metrics/job@base64/YS9i/empty@base64/=/path@base64/L3Zhci90bXA",
+		pushURL("http://gateway:9091", "a/b", map[string]string{"path": "/var/tmp", "empty": ""}))
+}
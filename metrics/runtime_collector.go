@@ -0,0 +1,249 @@
+package metrics
+
+import (
+	"bufio"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeMetrics are read through the runtime/metrics package. Names do not clash
+// with the go_* and process_* metrics of the default Prometheus registry.
+type runtimeMetrics struct {
+	Goroutines       Gauge   `metric:"runtime.goroutines"`
+	GoMaxProcs       Gauge   `metric:"runtime.gomaxprocs"`
+	TotalMemoryBytes Gauge   `metric:"runtime.memory.total_bytes"`
+	HeapBytes        Gauge   `metric:"runtime.memory.heap_bytes"`
+	HeapObjects      Gauge   `metric:"runtime.memory.heap_objects"`
+	HeapGoalBytes    Gauge   `metric:"runtime.memory.heap_goal_bytes"`
+	GCCycles         Counter `metric:"runtime.gc.cycles"`
+	GCPause          Timer   `metric:"runtime.gc.pause"`
+}
+
+// processMetrics are read from /proc/self and are only reported on Linux.
+type processMetrics struct {
+	OpenFDs             Gauge   `metric:"process.fds.open"`
+	MaxFDs              Gauge   `metric:"process.fds.max"`
+	ResidentMemoryBytes Gauge   `metric:"process.memory.resident_bytes"`
+	VirtualMemoryBytes  Gauge   `metric:"process.memory.virtual_bytes"`
+	CPUMilliseconds     Counter `metric:"process.cpu.milliseconds"`
+}
+
+const (
+	sampleGoroutines  = "/sched/goroutines:goroutines"
+	sampleGoMaxProcs  = "/sched/gomaxprocs:threads"
+	sampleTotalMemory = "/memory/classes/total:bytes"
+	sampleHeapBytes   = "/memory/classes/heap/objects:bytes"
+	sampleHeapObjects = "/gc/heap/objects:objects"
+	sampleHeapGoal    = "/gc/heap/goal:bytes"
+	sampleGCCycles    = "/gc/cycles/total:gc-cycles"
+	sampleGCPauses    = "/gc/pauses:seconds"
+	// userHZ is the kernel clock tick used by /proc/self/stat, fixed to 100 on all common architectures.
+	userHZ = 100
+)
+
+// RuntimeCollector periodically publishes Go runtime stats and Linux process stats
+// through a metrics.Factory.
+type RuntimeCollector struct {
+	runtime  runtimeMetrics
+	process  processMetrics
+	procPath string
+	samples  []metrics.Sample
+
+	lock         sync.Mutex
+	lastGCCycles uint64
+	lastPauses   []uint64
+	lastCPUTicks int64
+
+	stopCh   chan struct{}
+	stopWG   sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewRuntimeCollector creates a collector reporting through the given factory.
+func NewRuntimeCollector(factory Factory) *RuntimeCollector {
+	c := &RuntimeCollector{
+		procPath: "/proc/self",
+		stopCh:   make(chan struct{}),
+	}
+	Init(&c.runtime, factory, nil)
+	Init(&c.process, factory, nil)
+	for _, name := range []string{
+		sampleGoroutines, sampleGoMaxProcs, sampleTotalMemory, sampleHeapBytes,
+		sampleHeapObjects, sampleHeapGoal, sampleGCCycles, sampleGCPauses,
+	} {
+		c.samples = append(c.samples, metrics.Sample{Name: name})
+	}
+	return c
+}
+
+// Start starts a timer-based goroutine that collects and publishes the stats every reportPeriod.
+// GC pauses are recorded from now on.
+func (c *RuntimeCollector) Start(reportPeriod time.Duration) {
+	c.lock.Lock()
+	c.seedPauses()
+	c.lock.Unlock()
+	ticker := time.NewTicker(reportPeriod)
+	c.stopWG.Add(1)
+	go func() {
+		defer c.stopWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Collect()
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the reporting goroutine and blocks until it has exited.
+func (c *RuntimeCollector) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+	c.stopWG.Wait()
+}
+
+// Collect publishes the current stats once.
+func (c *RuntimeCollector) Collect() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.collectRuntime()
+	c.collectProcess()
+}
+
+func (c *RuntimeCollector) collectRuntime() {
+	metrics.Read(c.samples)
+	for _, s := range c.samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v := s.Value.Uint64()
+			switch s.Name {
+			case sampleGoroutines:
+				c.runtime.Goroutines.Update(int64(v))
+			case sampleGoMaxProcs:
+				c.runtime.GoMaxProcs.Update(int64(v))
+			case sampleTotalMemory:
+				c.runtime.TotalMemoryBytes.Update(int64(v))
+			case sampleHeapBytes:
+				c.runtime.HeapBytes.Update(int64(v))
+			case sampleHeapObjects:
+				c.runtime.HeapObjects.Update(int64(v))
+			case sampleHeapGoal:
+				c.runtime.HeapGoalBytes.Update(int64(v))
+			case sampleGCCycles:
+				c.runtime.GCCycles.Inc(int64(v - c.lastGCCycles))
+				c.lastGCCycles = v
+			}
+		case metrics.KindFloat64Histogram:
+			c.recordPauses(s.Value.Float64Histogram())
+		}
+	}
+}
+
+// seedPauses sets the pauses of the cumulative histogram so far as already recorded.
+func (c *RuntimeCollector) seedPauses() {
+	sample := []metrics.Sample{{Name: sampleGCPauses}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() == metrics.KindFloat64Histogram {
+		c.lastPauses = append([]uint64(nil), sample[0].Value.Float64Histogram().Counts...)
+	}
+}
+
+// recordPauses records the pauses added to the cumulative histogram since the
+// previous collection, each one at the upper bound of its bucket.
+func (c *RuntimeCollector) recordPauses(h *metrics.Float64Histogram) {
+	if len(c.lastPauses) != len(h.Counts) {
+		// not seeded by Start: the pauses so far are not replayed, only the next ones
+		c.lastPauses = append([]uint64(nil), h.Counts...)
+		return
+	}
+	for i, count := range h.Counts {
+		bound := h.Buckets[i+1]
+		if math.IsInf(bound, 1) {
+			bound = h.Buckets[i]
+		}
+		for n := c.lastPauses[i]; n < count; n++ {
+			c.runtime.GCPause.Record(time.Duration(bound * float64(time.Second)))
+		}
+		c.lastPauses[i] = count
+	}
+}
+
+func (c *RuntimeCollector) collectProcess() {
+	if fds, err := ioutil.ReadDir(filepath.Join(c.procPath, "fd")); err == nil {
+		c.process.OpenFDs.Update(int64(len(fds)))
+	}
+	if maxFDs, err := c.readMaxFDs(); err == nil {
+		c.process.MaxFDs.Update(maxFDs)
+	}
+	if stat, err := c.readStat(); err == nil {
+		c.process.VirtualMemoryBytes.Update(stat.vsize)
+		c.process.ResidentMemoryBytes.Update(stat.rss * int64(os.Getpagesize()))
+		ticks := stat.utime + stat.stime
+		c.process.CPUMilliseconds.Inc((ticks - c.lastCPUTicks) * 1000 / userHZ)
+		c.lastCPUTicks = ticks
+	}
+}
+
+func (c *RuntimeCollector) readMaxFDs() (int64, error) {
+	f, err := os.Open(filepath.Join(c.procPath, "limits"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.ParseInt(fields[0], 10, 64)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, os.ErrNotExist
+}
+
+type procStat struct {
+	utime int64
+	stime int64
+	vsize int64
+	rss   int64
+}
+
+func (c *RuntimeCollector) readStat() (*procStat, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.procPath, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// the command name may contain spaces, fields are counted after its closing parenthesis
+	text := string(data)
+	fields := strings.Fields(text[strings.LastIndex(text, ")")+1:])
+	if len(fields) < 22 {
+		return nil, os.ErrInvalid
+	}
+	values := make([]int64, 0, 4)
+	for _, i := range []int{11, 12, 20, 21} {
+		v, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return &procStat{utime: values[0], stime: values[1], vsize: values[2], rss: values[3]}, nil
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeCollector(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	c := NewRuntimeCollector(f)
+	c.procPath = fakeProc(t, 1000, 100)
+
+	runtime.GC()
+	c.Collect()
+
+	counters, gauges := f.Snapshot()
+	assert.True(t, gauges["runtime.goroutines"] > 0)
+	assert.EqualValues(t, runtime.GOMAXPROCS(0), gauges["runtime.gomaxprocs"])
+	assert.True(t, gauges["runtime.memory.total_bytes"] > 0)
+	assert.True(t, counters["runtime.gc.cycles"] > 0)
+	assert.EqualValues(t, 3, gauges["process.fds.open"])
+	assert.EqualValues(t, 4096, gauges["process.fds.max"])
+	assert.EqualValues(t, 123456, gauges["process.memory.virtual_bytes"])
+	assert.EqualValues(t, 10*os.Getpagesize(), gauges["process.memory.resident_bytes"])
+	assert.EqualValues(t, 11000, counters["process.cpu.milliseconds"])
+
+	c.procPath = fakeProc(t, 1100, 150)
+	c.Collect()
+	counters, _ = f.Snapshot()
+	assert.EqualValues(t, 12500, counters["process.cpu.milliseconds"])
+}
+
+func TestRuntimeCollectorPauses(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	runtime.GC()
+	c := NewRuntimeCollector(f)
+	c.Start(time.Hour)
+	defer c.Stop()
+
+	c.Collect()
+	assert.EqualValues(t, 0, f.SnapshotDetailed().Timers["runtime.gc.pause"].Count, "pauses before Start")
+
+	runtime.GC()
+	c.Collect()
+	var total uint64
+	for _, count := range c.lastPauses {
+		total += count
+	}
+	pauses := f.SnapshotDetailed().Timers["runtime.gc.pause"].Count
+	assert.True(t, pauses > 0, "pauses after Start")
+	assert.True(t, uint64(pauses) < total, "%d pauses recorded out of %d", pauses, total)
+}
+
+func TestRuntimeCollectorStartStop(t *testing.T) {
+	f := NewLocalFactory(0)
+	defer f.Stop()
+	c := NewRuntimeCollector(f)
+	c.Start(time.Millisecond)
+
+	for i := 0; i < 1000; i++ {
+		if _, g := f.Snapshot(); g["runtime.goroutines"] > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Stop()
+	c.Stop()
+
+	_, g := f.Snapshot()
+	assert.True(t, g["runtime.goroutines"] > 0)
+}
+
+// fakeProc creates a /proc/self like directory with the given utime and stime ticks.
+func fakeProc(t *testing.T, utime, stime int) string {
+	dir, err := ioutil.TempDir("", "proc")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "fd"), 0755))
+	for _, fd := range []string{"0", "1", "2"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fd", fd), nil, 0644))
+	}
+	limits := "Limit                     Soft Limit           Hard Limit           Units\n" +
+		"Max open files            4096                 8192                 files\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "limits"), []byte(limits), 0644))
+	stat := "42 (my (odd) cmd) S 1 42 42 0 -1 4194560 100 0 0 0 " +
+		strconv.Itoa(utime) + " " + strconv.Itoa(stime) + " 0 0 20 0 8 0 1000 123456 10 18446744073709551615\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644))
+	return dir
+}
@@ -0,0 +1,341 @@
+package metrics
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsdFactory implements metrics.Factory backed by a UDP StatsD client.
+// Counters and gauges are aggregated on the client side and sent every flush interval,
+// timer and histogram samples are buffered into packets of at most the max packet size.
+type StatsdFactory struct {
+	scope  string
+	tags   map[string]string
+	client *statsdClient
+}
+
+type statsdOptions struct {
+	flushInterval time.Duration
+	maxPacketSize int
+	prefix        string
+	dogStatsD     bool
+}
+
+// StatsdOption is a function that sets some option for the StatsdFactory constructor.
+type StatsdOption func(*statsdOptions)
+
+// WithStatsdFlushInterval returns an option that sets how often aggregated metrics are sent.
+// If not used we fallback to one second.
+func WithStatsdFlushInterval(interval time.Duration) StatsdOption {
+	return func(opts *statsdOptions) {
+		opts.flushInterval = interval
+	}
+}
+
+// WithStatsdMaxPacketSize returns an option that sets the maximum size in bytes of a single UDP packet.
+// If not used we fallback to 1432, which fits a typical ethernet MTU.
+func WithStatsdMaxPacketSize(size int) StatsdOption {
+	return func(opts *statsdOptions) {
+		opts.maxPacketSize = size
+	}
+}
+
+// WithStatsdPrefix returns an option that sets a prefix added to every metric name.
+func WithStatsdPrefix(prefix string) StatsdOption {
+	return func(opts *statsdOptions) {
+		opts.prefix = prefix
+	}
+}
+
+// WithStatsdDogStatsD returns an option that selects how tags are sent. When enabled (the default)
+// tags are sent in the DogStatsD "|#key:value" format, otherwise they are appended to the metric name.
+func WithStatsdDogStatsD(enabled bool) StatsdOption {
+	return func(opts *statsdOptions) {
+		opts.dogStatsD = enabled
+	}
+}
+
+func applyStatsdOptions(opts []StatsdOption) *statsdOptions {
+	options := &statsdOptions{
+		dogStatsD: true,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	if options.flushInterval <= 0 {
+		options.flushInterval = time.Second
+	}
+	if options.maxPacketSize <= 0 {
+		options.maxPacketSize = 1432
+	}
+	return options
+}
+
+// NewStatsdFactory creates a StatsdFactory sending metrics to the StatsD agent at hostPort.
+func NewStatsdFactory(hostPort string, opts ...StatsdOption) (*StatsdFactory, error) {
+	options := applyStatsdOptions(opts)
+	conn, err := net.Dial("udp", hostPort)
+	if err != nil {
+		return nil, err
+	}
+	c := &statsdClient{
+		conn:          conn,
+		maxPacketSize: options.maxPacketSize,
+		prefix:        options.prefix,
+		dogStatsD:     options.dogStatsD,
+		counters:      make(map[statsdKey]int64),
+		gauges:        make(map[statsdKey]int64),
+		stop:          make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.runLoop(options.flushInterval)
+	return &StatsdFactory{client: c}, nil
+}
+
+// Counter implements Counter of metrics.Factory.
+func (f *StatsdFactory) Counter(name string, tags map[string]string) Counter {
+	return &statsdCounter{key: f.client.key(f.subScope(name), f.mergeTags(tags)), client: f.client}
+}
+
+// Gauge implements Gauge of metrics.Factory.
+func (f *StatsdFactory) Gauge(name string, tags map[string]string) Gauge {
+	return &statsdGauge{key: f.client.key(f.subScope(name), f.mergeTags(tags)), client: f.client}
+}
+
+// Timer implements Timer of metrics.Factory, durations are sent in milliseconds.
+func (f *StatsdFactory) Timer(name string, tags map[string]string) Timer {
+	return &statsdTimer{key: f.client.key(f.subScope(name), f.mergeTags(tags)), client: f.client}
+}
+
+// Histogram implements Histogram of metrics.Factory. Buckets are computed by the StatsD agent, so
+// the buckets argument is ignored.
+func (f *StatsdFactory) Histogram(name string, tags map[string]string, buckets []float64) Histogram {
+	return &statsdHistogram{key: f.client.key(f.subScope(name), f.mergeTags(tags)), client: f.client}
+}
+
+// Namespace implements Namespace of metrics.Factory.
+func (f *StatsdFactory) Namespace(name string, tags map[string]string) Factory {
+	return &StatsdFactory{
+		scope:  f.subScope(name),
+		tags:   f.mergeTags(tags),
+		client: f.client,
+	}
+}
+
+// Flush sends all aggregated and buffered metrics.
+func (f *StatsdFactory) Flush() {
+	f.client.flush()
+}
+
+// Close stops the background flushing, sends the remaining metrics and closes the connection.
+func (f *StatsdFactory) Close() error {
+	return f.client.close()
+}
+
+func (f *StatsdFactory) subScope(name string) string {
+	if f.scope == "" {
+		return name
+	}
+	if name == "" {
+		return f.scope
+	}
+	return f.scope + "." + name
+}
+
+func (f *StatsdFactory) mergeTags(tags map[string]string) map[string]string {
+	ret := make(map[string]string, len(f.tags)+len(tags))
+	for k, v := range f.tags {
+		ret[k] = v
+	}
+	for k, v := range tags {
+		ret[k] = v
+	}
+	return ret
+}
+
+// statsdKey identifies a single series, suffix holds the encoded DogStatsD tags if any.
+type statsdKey struct {
+	name   string
+	suffix string
+}
+
+type statsdClient struct {
+	conn          net.Conn
+	maxPacketSize int
+	prefix        string
+	dogStatsD     bool
+
+	lock     sync.Mutex
+	counters map[statsdKey]int64
+	gauges   map[statsdKey]int64
+	packet   bytes.Buffer
+	closed   bool
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// statsdReplacer replaces the separators of the StatsD datagram in names and tags.
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "@", "_", "\n", "_")
+
+func (c *statsdClient) key(name string, tags map[string]string) statsdKey {
+	name = statsdReplacer.Replace(c.prefix + name)
+	if len(tags) == 0 {
+		return statsdKey{name: name}
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if !c.dogStatsD {
+		for _, k := range keys {
+			name = name + "." + statsdReplacer.Replace(k) + "." + statsdReplacer.Replace(tags[k])
+		}
+		return statsdKey{name: name}
+	}
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, statsdReplacer.Replace(k)+":"+statsdReplacer.Replace(tags[k]))
+	}
+	return statsdKey{name: name, suffix: "|#" + strings.Join(pairs, ",")}
+}
+
+func (c *statsdClient) runLoop(flushInterval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *statsdClient) incCounter(key statsdKey, delta int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.counters[key] += delta
+}
+
+func (c *statsdClient) updateGauge(key statsdKey, value int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.gauges[key] = value
+}
+
+func (c *statsdClient) recordSample(key statsdKey, value float64, kind string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writeLine(key, strconv.FormatFloat(value, 'f', -1, 64), kind)
+}
+
+func (c *statsdClient) flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, value := range c.counters {
+		c.writeLine(key, strconv.FormatInt(value, 10), "c")
+	}
+	for key, value := range c.gauges {
+		if value < 0 {
+			// a signed gauge value is interpreted as a delta, so reset it first
+			c.writeLine(key, "0", "g")
+		}
+		c.writeLine(key, strconv.FormatInt(value, 10), "g")
+	}
+	c.counters = make(map[statsdKey]int64)
+	c.gauges = make(map[statsdKey]int64)
+	c.sendPacket()
+}
+
+// writeLine appends a line to the current packet, sending the packet first if the
+// line does not fit in it anymore. Must be called with the lock held.
+func (c *statsdClient) writeLine(key statsdKey, value, kind string) {
+	size := len(key.name) + 1 + len(value) + 1 + len(kind) + len(key.suffix)
+	if c.packet.Len() > 0 && c.packet.Len()+1+size > c.maxPacketSize {
+		c.sendPacket()
+	}
+	if c.packet.Len() > 0 {
+		c.packet.WriteByte('\n')
+	}
+	c.packet.WriteString(key.name)
+	c.packet.WriteByte(':')
+	c.packet.WriteString(value)
+	c.packet.WriteByte('|')
+	c.packet.WriteString(kind)
+	c.packet.WriteString(key.suffix)
+}
+
+// sendPacket must be called with the lock held.
+func (c *statsdClient) sendPacket() {
+	if c.packet.Len() == 0 || c.closed {
+		c.packet.Reset()
+		return
+	}
+	// errors are ignored, StatsD over UDP is fire and forget
+	c.conn.Write(c.packet.Bytes())
+	c.packet.Reset()
+}
+
+func (c *statsdClient) close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		c.wg.Wait()
+		c.flush()
+		c.lock.Lock()
+		c.closed = true
+		c.lock.Unlock()
+		err = c.conn.Close()
+	})
+	return err
+}
+
+type statsdCounter struct {
+	key    statsdKey
+	client *statsdClient
+}
+
+func (c *statsdCounter) Inc(delta int64) {
+	c.client.incCounter(c.key, delta)
+}
+
+type statsdGauge struct {
+	key    statsdKey
+	client *statsdClient
+}
+
+func (g *statsdGauge) Update(value int64) {
+	g.client.updateGauge(g.key, value)
+}
+
+type statsdTimer struct {
+	key    statsdKey
+	client *statsdClient
+}
+
+func (t *statsdTimer) Record(d time.Duration) {
+	t.client.recordSample(t.key, float64(d)/float64(time.Millisecond), "ms")
+}
+
+type statsdHistogram struct {
+	key    statsdKey
+	client *statsdClient
+}
+
+func (h *statsdHistogram) Record(value float64) {
+	kind := "ms"
+	if h.client.dogStatsD {
+		kind = "h"
+	}
+	h.client.recordSample(h.key, value, kind)
+}
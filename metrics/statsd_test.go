@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type statsdListener struct {
+	t    *testing.T
+	conn net.PacketConn
+}
+
+func newStatsdListener(t *testing.T) *statsdListener {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return &statsdListener{t: t, conn: conn}
+}
+
+func (l *statsdListener) addr() string {
+	return l.conn.LocalAddr().String()
+}
+
+// packets reads datagrams until no more arrive within a short timeout.
+func (l *statsdListener) packets() []string {
+	var packets []string
+	buf := make([]byte, 65536)
+	for {
+		l.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+}
+
+func (l *statsdListener) lines() []string {
+	var lines []string
+	for _, p := range l.packets() {
+		lines = append(lines, strings.Split(p, "\n")...)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestStatsdFactory(t *testing.T) {
+	l := newStatsdListener(t)
+	defer l.conn.Close()
+
+	f, err := NewStatsdFactory(l.addr(), WithStatsdFlushInterval(time.Hour), WithStatsdPrefix("svc."))
+	require.NoError(t, err)
+	ns := f.Namespace("bender", map[string]string{"a": "b"})
+	c := ns.Counter("rodriguez", map[string]string{"x": "y"})
+	c.Inc(1)
+	c.Inc(2)
+	ns.Gauge("level", nil).Update(-3)
+	ns.Timer("latency", nil).Record(1500 * time.Microsecond)
+	f.Histogram("size", nil, nil).Record(42)
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []string{
+		"svc.bender.latency:1.5|ms|#a:b",
+		"svc.bender.level:-3|g|#a:b",
+		"svc.bender.level:0|g|#a:b",
+		"svc.bender.rodriguez:3|c|#a:b,x:y",
+		"svc.size:42|h",
+	}, l.lines())
+	assert.NoError(t, f.Close())
+}
+
+func TestStatsdFactoryPlainTags(t *testing.T) {
+	l := newStatsdListener(t)
+	defer l.conn.Close()
+
+	f, err := NewStatsdFactory(l.addr(), WithStatsdDogStatsD(false))
+	require.NoError(t, err)
+	defer f.Close()
+	f.Counter("requests", map[string]string{"code": "200", "method": "get"}).Inc(1)
+	f.Histogram("size", nil, nil).Record(0.5)
+	f.Flush()
+
+	assert.Equal(t, []string{
+		"requests.code.200.method.get:1|c",
+		"size:0.5|ms",
+	}, l.lines())
+}
+
+func TestStatsdFactorySanitizesTags(t *testing.T) {
+	l := newStatsdListener(t)
+	defer l.conn.Close()
+
+	f, err := NewStatsdFactory(l.addr())
+	require.NoError(t, err)
+	defer f.Close()
+	f.Counter("req:uests|x", map[string]string{"url": "/a?b=1,c=2|#3", "k:ey": "v\nal"}).Inc(1)
+	f.Flush()
+
+	assert.Equal(t, []string{"req_uests_x:1|c|#k_ey:v_al,url:/a?b=1_c=2__3"}, l.lines())
+
+	plain, err := NewStatsdFactory(l.addr(), WithStatsdDogStatsD(false))
+	require.NoError(t, err)
+	defer plain.Close()
+	plain.Counter("requests", map[string]string{"url": "a:b|c"}).Inc(1)
+	plain.Flush()
+
+	assert.Equal(t, []string{"requests.url.a_b_c:1|c"}, l.lines())
+}
+
+func TestStatsdFactoryMaxPacketSize(t *testing.T) {
+	l := newStatsdListener(t)
+	defer l.conn.Close()
+
+	f, err := NewStatsdFactory(l.addr(), WithStatsdMaxPacketSize(32), WithStatsdFlushInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	defer f.Close()
+	timer := f.Timer("some.timer", nil)
+	for i := 0; i < 10; i++ {
+		timer.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	packets := l.packets()
+	var lines int
+	for _, p := range packets {
+		assert.True(t, len(p) <= 32, "packet too large: %q", p)
+		lines += len(strings.Split(p, "\n"))
+	}
+	assert.True(t, len(packets) > 1)
+	assert.Equal(t, 10, lines)
+}
@@ -15,6 +15,7 @@
 package metrics
 
 import (
+	"context"
 	"time"
 )
 
@@ -25,6 +26,21 @@ type Timer interface {
 	Record(time.Duration)
 }
 
+// ContextTimer is implemented by timers that use the context of a recording, e.g. to
+// attach the trace ID of the active span as an exemplar.
+type ContextTimer interface {
+	RecordContext(ctx context.Context, d time.Duration)
+}
+
+// RecordTimer records d to t, passing ctx along if t is a ContextTimer.
+func RecordTimer(ctx context.Context, t Timer, d time.Duration) {
+	if ct, ok := t.(ContextTimer); ok {
+		ct.RecordContext(ctx, d)
+		return
+	}
+	t.Record(d)
+}
+
 // NullTimer timer that does nothing
 var NullTimer Timer = nullTimer{}
 
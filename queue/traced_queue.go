@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/liornabat/golibs/metrics"
+	"github.com/liornabat/golibs/tracing"
+)
+
+// TracedQueue is a BoundedQueue that carries the span context of the producer with every
+// item, so that the trace continues in the consumer. Each item is consumed within a consumer
+// span that follows from the producer span, tagged with the time the item waited in the queue.
+type TracedQueue struct {
+	queue    *BoundedQueue
+	spanName string
+	waitTime metrics.Timer
+}
+
+type tracedItem struct {
+	envelope *tracing.Envelope
+	produced time.Time
+}
+
+// NewTracedQueue constructs the new queue of specified capacity, whose consumer spans are
+// named spanName. The optional waitTime timer records how long items waited in the queue,
+// and the optional onDroppedItem callback is called with the dropped items.
+func NewTracedQueue(capacity int, spanName string, waitTime metrics.Timer, onDroppedItem func(item interface{})) *TracedQueue {
+	if waitTime == nil {
+		waitTime = metrics.NullTimer
+	}
+	return &TracedQueue{
+		queue: NewBoundedQueue(capacity, func(item interface{}) {
+			if onDroppedItem != nil {
+				onDroppedItem(item.(*tracedItem).envelope.Item)
+			}
+		}),
+		spanName: spanName,
+		waitTime: waitTime,
+	}
+}
+
+// StartConsumers starts a given number of goroutines consuming items from the queue and
+// passing them into the consumer callback, with a context carrying the consumer span.
+func (q *TracedQueue) StartConsumers(num int, consumer func(ctx context.Context, item interface{})) {
+	q.queue.StartConsumers(num, func(item interface{}) {
+		ti := item.(*tracedItem)
+		wait := time.Since(ti.produced)
+		ctx, span := ti.envelope.StartSpan(q.spanName)
+		defer span.Finish()
+		span.SetComponent("queue")
+		span.SetTag("queue.wait_ms", float64(wait)/float64(time.Millisecond))
+		metrics.RecordTimer(ctx, q.waitTime, wait)
+		consumer(ctx, ti.envelope.Item)
+	})
+}
+
+// Produce is used by the producer to submit new item to the queue, with the span context of
+// the span carried by ctx, if any. Returns false in case of queue overflow.
+func (q *TracedQueue) Produce(ctx context.Context, item interface{}) bool {
+	return q.queue.Produce(&tracedItem{
+		envelope: tracing.NewEnvelope(ctx, item),
+		produced: time.Now(),
+	})
+}
+
+// Stop stops all consumers, see BoundedQueue.Stop.
+func (q *TracedQueue) Stop() {
+	q.queue.Stop()
+}
+
+// Size returns the current size of the queue
+func (q *TracedQueue) Size() int {
+	return q.queue.Size()
+}
+
+// Capacity returns capacity of the queue
+func (q *TracedQueue) Capacity() int {
+	return q.queue.Capacity()
+}
+
+// StartLengthReporting periodically reports current queue length to a given metrics gauge,
+// see BoundedQueue.StartLengthReporting.
+func (q *TracedQueue) StartLengthReporting(reportPeriod time.Duration, gauge metrics.Gauge) {
+	q.queue.StartLengthReporting(reportPeriod, gauge)
+}
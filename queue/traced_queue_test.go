@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liornabat/golibs/metrics"
+	"github.com/liornabat/golibs/tracing"
+)
+
+// In this test the producer submits an item from within a span, and then items from a
+// context without a span while the consumer is blocked, so that they wait in the queue.
+func TestTracedQueue(t *testing.T) {
+	recorder := tracing.InitTracingForTest()
+	mFact := metrics.NewLocalFactory(0)
+	var dropped []interface{}
+	q := NewTracedQueue(2, "consume", mFact.Timer("wait", nil), func(item interface{}) {
+		dropped = append(dropped, item)
+	})
+	assert.Equal(t, 2, q.Capacity())
+
+	var startLock sync.Mutex
+	startLock.Lock() // block consumers
+	consumerState := newConsumerState(t)
+	spans := make(map[string]opentracing.Span)
+	q.StartConsumers(1, func(ctx context.Context, item interface{}) {
+		consumerState.Lock()
+		spans[item.(string)] = opentracing.SpanFromContext(ctx)
+		consumerState.Unlock()
+		consumerState.record(item.(string))
+
+		// block further processing until startLock is released
+		startLock.Lock()
+		startLock.Unlock()
+	})
+
+	ctx, producer := tracing.StartSpan(context.Background(), "produce")
+	assert.True(t, q.Produce(ctx, "a"))
+	producer.Finish()
+	consumerState.waitToConsumeOnce()
+
+	assert.True(t, q.Produce(context.Background(), "b"))
+	assert.True(t, q.Produce(context.Background(), "c"))
+	assert.False(t, q.Produce(context.Background(), "d"))
+	assert.Equal(t, []interface{}{"d"}, dropped)
+	assert.Equal(t, 2, q.Size())
+
+	time.Sleep(5 * time.Millisecond)
+	startLock.Unlock() // unblock consumer
+	consumerState.assertConsumed(map[string]bool{"a": true, "b": true, "c": true})
+	q.Stop()
+
+	consumers := recorder.FindByName("consume")
+	require.Len(t, consumers, 3)
+	assert.Equal(t, recorder.FindByName("produce")[0], recorder.Parent(consumers[0]))
+	assert.Nil(t, recorder.Parent(consumers[1]), "produced without a span")
+	for i, s := range consumers {
+		assert.Equal(t, spans[[]string{"a", "b", "c"}[i]], opentracing.Span(s))
+		assert.Equal(t, "queue", s.Tag("component"))
+		assert.EqualValues(t, "consumer", s.Tag("span.kind"))
+		assert.IsType(t, float64(0), s.Tag("queue.wait_ms"))
+	}
+	// "b" and "c" waited for the consumer to be unblocked
+	assert.GreaterOrEqual(t, consumers[1].Tag("queue.wait_ms"), 5.0)
+	assert.GreaterOrEqual(t, consumers[2].Tag("queue.wait_ms"), 5.0)
+
+	timer := mFact.SnapshotDetailed().Timers["wait"]
+	assert.EqualValues(t, 3, timer.Count)
+	assert.GreaterOrEqual(t, timer.Max, 5*time.Millisecond)
+}
@@ -0,0 +1,157 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// binaryVersion is the first byte of the binary encoding of SpanContext. Decoders reject
+// versions they do not know, so the version must change with the layout.
+const binaryVersion byte = 1
+
+// Flags of the binary encoding.
+const (
+	binaryFlagSampled byte = 1 << iota
+	binaryFlagDebug
+)
+
+// MarshalBinary encodes the span context as
+//
+//	version:1 trace-id-high:8 trace-id-low:8 span-id:8 parent-id:8 flags:1
+//	tracestate:string baggage-count:uvarint (key:string value:string)*
+//
+// with big endian integers, and strings prefixed by their uvarint length.
+func (sc SpanContext) MarshalBinary() ([]byte, error) {
+	size := 34 + binary.MaxVarintLen64 + len(sc.TraceState)
+	for k, v := range sc.Baggage {
+		size += 2*binary.MaxVarintLen64 + len(k) + len(v)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, binaryVersion)
+	buf = binary.BigEndian.AppendUint64(buf, sc.TraceID.High)
+	buf = binary.BigEndian.AppendUint64(buf, sc.TraceID.Low)
+	buf = binary.BigEndian.AppendUint64(buf, sc.SpanID)
+	buf = binary.BigEndian.AppendUint64(buf, sc.ParentID)
+	var flags byte
+	if sc.Sampled {
+		flags |= binaryFlagSampled
+	}
+	if sc.Debug {
+		flags |= binaryFlagDebug
+	}
+	buf = append(buf, flags)
+	buf = appendBinaryString(buf, sc.TraceState)
+	buf = binary.AppendUvarint(buf, uint64(len(sc.Baggage)))
+	for _, k := range sortedKeys(sc.Baggage) {
+		buf = appendBinaryString(buf, k)
+		buf = appendBinaryString(buf, sc.Baggage[k])
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes an encoding of MarshalBinary. It returns
+// opentracing.ErrSpanContextNotFound if data is empty, and
+// opentracing.ErrSpanContextCorrupted, possibly wrapped, if it is truncated, of an unknown
+// version or holds an invalid span context.
+func (sc *SpanContext) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return opentracing.ErrSpanContextNotFound
+	}
+	if data[0] != binaryVersion {
+		return fmt.Errorf("unsupported span context encoding version %d: %w", data[0], opentracing.ErrSpanContextCorrupted)
+	}
+	r := &binaryReader{data: data[1:]}
+	decoded := SpanContext{
+		TraceID:  TraceID{High: r.uint64(), Low: r.uint64()},
+		SpanID:   r.uint64(),
+		ParentID: r.uint64(),
+	}
+	flags := r.byte()
+	decoded.Sampled = flags&binaryFlagSampled != 0
+	decoded.Debug = flags&binaryFlagDebug != 0
+	decoded.TraceState = r.string()
+	count := r.uvarint()
+	// every baggage item takes at least 2 bytes, the lengths of its key and value
+	if count > uint64(len(r.data))/2 {
+		return opentracing.ErrSpanContextCorrupted
+	}
+	if count > 0 {
+		decoded.Baggage = make(map[string]string, count)
+		for i := uint64(0); i < count && !r.failed; i++ {
+			k := r.string()
+			decoded.Baggage[k] = r.string()
+		}
+	}
+	if r.failed || len(r.data) > 0 || !decoded.IsValid() {
+		return opentracing.ErrSpanContextCorrupted
+	}
+	*sc = decoded
+	return nil
+}
+
+func appendBinaryString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// binaryReader reads the fields of an encoding, failed is set once a field is truncated.
+type binaryReader struct {
+	data   []byte
+	failed bool
+}
+
+func (r *binaryReader) uint64() uint64 {
+	if r.failed || len(r.data) < 8 {
+		r.failed = true
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *binaryReader) byte() byte {
+	if r.failed || len(r.data) < 1 {
+		r.failed = true
+		return 0
+	}
+	v := r.data[0]
+	r.data = r.data[1:]
+	return v
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.failed {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.failed = true
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) string() string {
+	n := r.uvarint()
+	if r.failed || n > uint64(len(r.data)) {
+		r.failed = true
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+// FromBinary returns the span context of the tracer of an encoding of Span.ToBinary, e.g. to
+// start a span with opentracing.ChildOf.
+func FromBinary(in []byte) (opentracing.SpanContext, error) {
+	var sc SpanContext
+	if err := sc.UnmarshalBinary(in); err != nil {
+		return nil, err
+	}
+	return GetTracer().tracerSpanContext(sc)
+}
@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanContextBinary(t *testing.T) {
+	sc := SpanContext{
+		TraceID:    traceID128,
+		SpanID:     0x00f067aa0ba902b7,
+		ParentID:   0x0020000000000001,
+		Sampled:    true,
+		TraceState: "rojo=1",
+		Baggage:    map[string]string{"user": "alice", "tenant": "acme"},
+	}
+	data, err := sc.MarshalBinary()
+	require.NoError(t, err)
+	// the layout of version 1 must not change
+	assert.Equal(t, "01"+"4bf92f3577b34da6"+"a3ce929d0e0e4736"+"00f067aa0ba902b7"+"0020000000000001"+"01"+
+		"06"+hex.EncodeToString([]byte("rojo=1"))+"02"+
+		"06"+hex.EncodeToString([]byte("tenant"))+"04"+hex.EncodeToString([]byte("acme"))+
+		"04"+hex.EncodeToString([]byte("user"))+"05"+hex.EncodeToString([]byte("alice")),
+		hex.EncodeToString(data))
+
+	var decoded SpanContext
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, sc, decoded)
+
+	debug := SpanContext{TraceID: traceID64, SpanID: 1, Debug: true}
+	data, err = debug.MarshalBinary()
+	require.NoError(t, err)
+	decoded = SpanContext{}
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, debug, decoded)
+}
+
+func TestSpanContextBinaryErrors(t *testing.T) {
+	data, err := SpanContext{TraceID: traceID128, SpanID: 1, Baggage: map[string]string{"user": "alice"}}.MarshalBinary()
+	require.NoError(t, err)
+
+	var sc SpanContext
+	assert.Equal(t, opentracing.ErrSpanContextNotFound, sc.UnmarshalBinary(nil))
+	err = sc.UnmarshalBinary(append([]byte{2}, data[1:]...))
+	assert.True(t, errors.Is(err, opentracing.ErrSpanContextCorrupted), "unknown version")
+	assert.Contains(t, err.Error(), "unsupported span context encoding version 2")
+	for i := 1; i < len(data); i++ {
+		assert.Equal(t, opentracing.ErrSpanContextCorrupted, sc.UnmarshalBinary(data[:i]), "truncated to %d bytes", i)
+	}
+	assert.Equal(t, opentracing.ErrSpanContextCorrupted, sc.UnmarshalBinary(append(data, 0)), "trailing bytes")
+	zero, err := SpanContext{}.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, opentracing.ErrSpanContextCorrupted, sc.UnmarshalBinary(zero), "zero IDs")
+	huge := append(data[:35:35], 0xff, 0xff, 0xff, 0xff, 0x0f)
+	assert.Equal(t, opentracing.ErrSpanContextCorrupted, sc.UnmarshalBinary(huge), "baggage count")
+	// 3 items cannot fit in the 4 remaining bytes
+	short := append(data[:35:35], 3, 1, 'k', 1, 'v')
+	assert.Equal(t, opentracing.ErrSpanContextCorrupted, sc.UnmarshalBinary(short), "baggage count larger than the remaining items")
+	assert.Equal(t, SpanContext{}, sc)
+}
+
+func TestToBinaryFromBinary(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, init func(ops TracingOptions) error) {
+		require.NoError(t, init(TracingOptions{}))
+		defer CloseTracing(context.Background())
+		_, producer := StartSpan(context.Background(), "producer")
+		producer.SetBaggage("tenant", "acme")
+		defer producer.Finish()
+
+		data := producer.ToBinary()
+		require.NotEmpty(t, data)
+		wireContext, err := FromBinary(data)
+		require.NoError(t, err)
+		assert.Equal(t, producer.TraceID(), traceID(wireContext))
+		baggage := make(map[string]string)
+		wireContext.ForeachBaggageItem(func(k, v string) bool {
+			baggage[k] = v
+			return true
+		})
+		assert.Equal(t, map[string]string{"tenant": "acme"}, baggage)
+
+		_, consumer, err := StartSpanFromBinary("consumer", data)
+		require.NoError(t, err)
+		assert.Equal(t, producer.TraceID(), consumer.TraceID())
+		assert.Equal(t, "acme", consumer.GetBaggage("tenant"))
+		consumer.Finish()
+	})
+}
+
+func TestEnvelope(t *testing.T) {
+	recorder := InitTracingForTest()
+	defer InitTracingForTest()
+
+	ctx, producer := StartSpan(context.Background(), "producer")
+	producer.SetBaggage("tenant", "acme")
+	e := NewEnvelope(ctx, "item")
+	producer.Finish()
+	assert.Equal(t, "item", e.Item)
+	assert.NotEmpty(t, e.SpanContext)
+
+	ctx, consumer := e.StartSpan("consumer")
+	assert.Equal(t, consumer.Span, opentracing.SpanFromContext(ctx))
+	assert.Equal(t, "acme", consumer.GetBaggage("tenant"))
+	consumer.Finish()
+
+	orphan := NewEnvelope(context.Background(), "orphan")
+	assert.Nil(t, orphan.SpanContext)
+	_, root := orphan.StartSpan("orphan consumer")
+	root.Finish()
+
+	consumers := recorder.FindByName("consumer")
+	require.Len(t, consumers, 1)
+	assert.Equal(t, recorder.FindByName("producer")[0], recorder.Parent(consumers[0]))
+	assert.EqualValues(t, "consumer", consumers[0].Tag("span.kind"))
+	roots := recorder.FindByName("orphan consumer")
+	require.Len(t, roots, 1)
+	assert.Nil(t, recorder.Parent(roots[0]))
+}
+
+func TestBinaryBeforeInit(t *testing.T) {
+	tracerFactory.Store(newNoopFactory())
+	opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	defer InitTracingForTest()
+
+	ctx, span := StartSpan(context.Background(), "noop")
+	assert.Nil(t, span.ToBinary())
+	e := NewEnvelope(ctx, "item")
+	assert.Nil(t, e.SpanContext)
+	_, consumer := e.StartSpan("consumer")
+	consumer.Finish()
+	span.Finish()
+}
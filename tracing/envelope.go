@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Envelope carries an item with the binary span context of its producer, e.g. through a
+// queue.BoundedQueue or a message bus, so that the consumer continues the trace.
+type Envelope struct {
+	// SpanContext is the encoding of Span.ToBinary, nil if the producer had no span.
+	SpanContext []byte
+	Item        interface{}
+}
+
+// NewEnvelope wraps item with the span context of the span carried by ctx, if any.
+func NewEnvelope(ctx context.Context, item interface{}) *Envelope {
+	e := &Envelope{Item: item}
+	if ctx == nil {
+		return e
+	}
+	if s := opentracing.SpanFromContext(ctx); s != nil {
+		e.SpanContext = (&Span{Span: s}).ToBinary()
+	}
+	return e
+}
+
+// StartSpan starts a consumer span of the envelope, following from the producer span. A
+// new trace is started if the envelope has no valid span context.
+func (e *Envelope) StartSpan(spanName string) (context.Context, *Span) {
+	opts := []opentracing.StartSpanOption{ext.SpanKindConsumer}
+	if parent, err := FromBinary(e.SpanContext); err == nil && parent != nil {
+		opts = append(opts, opentracing.FollowsFrom(parent))
+	}
+	s := opentracing.StartSpan(spanName, opts...)
+	ctxOut := opentracing.ContextWithSpan(context.Background(), s)
+	span := &Span{
+		s,
+		ctxOut,
+	}
+	if GetTracer().SampleAllSpans {
+		span.SetSamplingPriority(1)
+	}
+	return ctxOut, span
+}
@@ -2,19 +2,84 @@ package tracing
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 
 	zipkin "github.com/openzipkin/zipkin-go-opentracing"
+
+	"github.com/liornabat/golibs/logging"
+)
+
+// Tracer backends of TracingOptions.Tracer.
+const (
+	TracerZipkin = "zipkin"
+	TracerJaeger = "jaeger"
+	TracerOTLP   = "otlp"
+)
+
+// Transports of TracingOptions.OTLPProtocol.
+const (
+	OTLPProtocolHTTP = "http/protobuf"
+	OTLPProtocolGRPC = "grpc"
+)
+
+// Sampler types of TracingOptions.SamplerType. The param of SamplerConst is 1 to sample all
+// spans or 0 to sample none, of SamplerProbabilistic the sampling probability, and of
+// SamplerRateLimiting the number of traces sampled per second.
+const (
+	SamplerConst         = "const"
+	SamplerProbabilistic = "probabilistic"
+	SamplerRateLimiting  = "ratelimiting"
 )
 
 type TracingOptions struct {
-	LocalHostPort  string
+	LocalHostPort string
+	// ReportHostPort is the Zipkin collector, the UDP agent of Jaeger, or the OTLP collector.
 	ReportHostPort string
 	Debug          bool
 	SampleAllSpans bool
-	Tracer         string
+	// Tracer selects the backend, TracerZipkin by default.
+	Tracer string
+
+	// CollectorEndpoint is the URL of the Jaeger HTTP collector, e.g.
+	// "http://jaeger:14268/api/traces". When set, spans are not sent to the UDP agent.
+	CollectorEndpoint string
+	CollectorUser     string
+	CollectorPassword string
+	// FlushInterval of the Jaeger reporter buffer, defaults to 1 second, or of the OTLP
+	// batch span processor, defaults to 5 seconds.
+	FlushInterval time.Duration
+
+	// SamplerType and SamplerParam select the sampling strategy of the traces, all the
+	// traces are sampled by default.
+	SamplerType  string
+	SamplerParam float64
+	// OperationSampling overrides SamplerType and SamplerParam for the traces started by the
+	// operations. TracerZipkin samples by trace ID only and ignores it.
+	OperationSampling []OperationStrategy
+	// SamplingSource is a file or an http(s) URL of a strategies file of the Jaeger collector.
+	// The strategy of the service, or else the default strategy, replaces the strategy of the
+	// options at init, and is reloaded every SamplingRefreshInterval, 1 minute by default.
+	SamplingSource          string
+	SamplingRefreshInterval time.Duration
+
+	// OTLPProtocol selects the transport of TracerOTLP, OTLPProtocolHTTP by default.
+	OTLPProtocol string
+	// OTLPInsecure disables TLS to the OTLP collector.
+	OTLPInsecure bool
+	// OTLPHeaders are sent with every export, e.g. for authentication.
+	OTLPHeaders map[string]string
+
+	// Propagators select the header formats of Inject and Extract, e.g.
+	// []string{PropagatorW3C, PropagatorB3Single}. Extract tries them in order and Inject
+	// writes them all. By default the native format of the tracer backend is used.
+	Propagators []string
 }
 
 type Factory struct {
@@ -24,7 +89,17 @@ type Factory struct {
 	defaultTags    *Tags
 	SampleAllSpans bool
 	cache          *spanCache
-	isClose        bool
+	closer         io.Closer
+	// native is the propagator of the native header format of the tracer, and propagator
+	// the propagator of the options, if any.
+	native Propagator
+	// mu guards propagator, which can be replaced by SetPropagator.
+	mu         sync.RWMutex
+	propagator Propagator
+	sampler    *sampler
+	stats      *spanStats
+	// closed is set by CloseTracing, spans finished afterwards are dropped.
+	closed int32
 }
 
 type SpanOptions struct {
@@ -32,25 +107,98 @@ type SpanOptions struct {
 	MustSample bool
 }
 
-var tracerFactory *Factory
+// tracerFactory holds the *Factory of InitTracing, a no-op factory until then, so that spans
+// can be started and finished before, or without, a tracer backend.
+var tracerFactory atomic.Value
 
-func InitTracing(serviceName string, ops TracingOptions, tags ...*Tags) error {
+func init() {
+	tracerFactory.Store(newNoopFactory())
+}
 
-	t, c, err := InitZipkin(ops, serviceName)
+// replacedShutdownTimeout bounds the flush of the factory replaced by InitTracing.
+const replacedShutdownTimeout = 5 * time.Second
+
+var tracingLogger = logging.NewLogger("tracing")
+
+// setTracerFactory shuts the current factory down, so that its reporter and sampling
+// refresh do not leak, and replaces it by f.
+func setTracerFactory(f *Factory) {
+	ctx, cancel := context.WithTimeout(context.Background(), replacedShutdownTimeout)
+	defer cancel()
+	if err := GetTracer().Shutdown(ctx); err != nil {
+		tracingLogger.Error(fmt.Errorf("unable to close the replaced tracer: %w", err))
+	}
+	tracerFactory.Store(f)
+}
+
+func newNoopFactory() *Factory {
+	return &Factory{
+		name:   "noop",
+		Tracer: opentracing.NoopTracer{},
+		cache:  newCache(),
+		closer: nopCloser{},
+		stats:  &spanStats{},
+	}
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func InitTracing(serviceName string, ops TracingOptions, tags ...*Tags) error {
+	var t opentracing.Tracer
+	var c zipkin.Collector
+	var closer io.Closer
+	var native, propagator Propagator
+	var err error
+	if len(ops.Propagators) > 0 {
+		if propagator, err = NewPropagator(ops.Propagators...); err != nil {
+			return err
+		}
+	}
+	switch ops.Tracer {
+	case "", TracerZipkin, TracerJaeger, TracerOTLP:
+	default:
+		return fmt.Errorf("unknown tracer %q", ops.Tracer)
+	}
+	s, err := newSampler(serviceName, ops)
 	if err != nil {
 		return err
 	}
+	stats := &spanStats{}
+	switch ops.Tracer {
+	case "", TracerZipkin:
+		t, c, err = initZipkin(ops, serviceName, s, stats)
+		closer = c
+		native = B3Propagator{}
+	case TracerJaeger:
+		t, closer, err = initJaeger(ops, serviceName, s, stats)
+		native = JaegerPropagator{}
+	case TracerOTLP:
+		t, closer, err = initOTLP(ops, serviceName, s, stats)
+		native = W3CPropagator{}
+	}
+	if err != nil {
+		return err
+	}
+	s.startRefresh(ops.SamplingRefreshInterval)
 
-	tracerFactory = &Factory{
+	f := &Factory{
 		name:           serviceName,
 		Tracer:         t,
 		Collector:      c,
 		SampleAllSpans: ops.SampleAllSpans,
 		cache:          newCache(),
+		closer:         closer,
+		native:         native,
+		propagator:     propagator,
+		sampler:        s,
+		stats:          stats,
 	}
 	if len(tags) > 0 {
-		tracerFactory.defaultTags = tags[0]
+		f.defaultTags = tags[0]
 	}
+	setTracerFactory(f)
 
 	return nil
 }
@@ -66,7 +214,7 @@ func StartSpan(ctx context.Context, spanName string) (context.Context, *Span) {
 	}
 
 	if span != nil {
-		if tracerFactory.SampleAllSpans {
+		if GetTracer().SampleAllSpans {
 			span.SetSamplingPriority(1)
 		}
 	}
@@ -77,7 +225,7 @@ func StartSpan(ctx context.Context, spanName string) (context.Context, *Span) {
 func StartSpanFromCache(spanName string, key string, moreKeys ...string) (context.Context, *Span) {
 	var span *Span
 	ctxOut := context.Background()
-	cacheSpan, ok := tracerFactory.cache.getSpan(key)
+	cacheSpan, ok := GetTracer().cache.getSpan(key)
 	if ok {
 		ctx := opentracing.ContextWithSpan(context.Background(), cacheSpan.Span)
 		s, c := opentracing.StartSpanFromContext(ctx, spanName)
@@ -88,7 +236,7 @@ func StartSpanFromCache(spanName string, key string, moreKeys ...string) (contex
 
 	} else {
 		for _, altKey := range moreKeys {
-			cacheSpan, ok := tracerFactory.cache.getSpan(altKey)
+			cacheSpan, ok := GetTracer().cache.getSpan(altKey)
 			if ok {
 				ctx := opentracing.ContextWithSpan(context.Background(), cacheSpan.Span)
 				s, c := opentracing.StartSpanFromContext(ctx, spanName)
@@ -103,7 +251,7 @@ func StartSpanFromCache(spanName string, key string, moreKeys ...string) (contex
 
 	}
 	if span != nil {
-		if tracerFactory.SampleAllSpans {
+		if GetTracer().SampleAllSpans {
 			span.SetSamplingPriority(1)
 		}
 		ctxOut = opentracing.ContextWithSpan(ctxOut, span.Span)
@@ -115,7 +263,7 @@ func StartSpanFromCache(spanName string, key string, moreKeys ...string) (contex
 func StartSpanFromBinary(spanName string, in []byte) (context.Context, *Span, error) {
 	var span *Span
 	var ctxOut context.Context = context.Background()
-	wireContext, err := tracerFactory.Extract(opentracing.Binary, in)
+	wireContext, err := FromBinary(in)
 	if wireContext == nil || err != nil {
 		return context.Background(), nil, err
 	}
@@ -124,21 +272,87 @@ func StartSpanFromBinary(spanName string, in []byte) (context.Context, *Span, er
 	}
 
 	if span != nil {
-		if tracerFactory.SampleAllSpans {
+		if GetTracer().SampleAllSpans {
 			span.SetSamplingPriority(1)
 		}
 		ctxOut = opentracing.ContextWithSpan(context.Background(), span.Span)
+		span.Context = ctxOut
 	}
 
 	return ctxOut, span, err
 }
 
-func CloseTracing() {
-	tracerFactory.isClose = true
-	tracerFactory.Close()
+// CloseTracing flushes the buffered spans and closes the reporter of the tracer backend,
+// giving up when ctx is done. Spans finished afterwards are dropped, see Factory.Stats.
+func CloseTracing(ctx context.Context) error {
+	return GetTracer().Shutdown(ctx)
+}
+
+// Close flushes and closes the reporter of the tracer backend.
+func (f *Factory) Close() error {
+	return f.Shutdown(context.Background())
+}
+
+// Shutdown flushes and closes the reporter of the tracer backend, giving up when ctx is
+// done. Closing a closed factory does nothing.
+func (f *Factory) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&f.closed, 0, 1) {
+		return nil
+	}
+	if f.sampler != nil {
+		f.sampler.close()
+	}
+	done := make(chan error, 1)
+	go func() {
+		if c, ok := f.closer.(interface{ Shutdown(context.Context) error }); ok {
+			done <- c.Shutdown(ctx)
+			return
+		}
+		done <- f.closer.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("unable to flush the tracer: %w", ctx.Err())
+	}
+}
+
+// IsClosed reports whether the tracer backend was closed by CloseTracing.
+func (f *Factory) IsClosed() bool {
+	return atomic.LoadInt32(&f.closed) != 0
+}
 
+// Stats returns the counts of the spans of the tracer backend.
+func (f *Factory) Stats() Stats {
+	return f.stats.snapshot()
+}
+
+// SamplingStrategy returns the current sampling strategy of the traces.
+func (f *Factory) SamplingStrategy() SamplingStrategy {
+	if f.sampler == nil {
+		return SamplingStrategy{Type: SamplerConst, Param: 1}
+	}
+	return f.sampler.strategy()
+}
+
+// SetSamplingStrategy replaces the sampling strategy of the traces started from now on.
+func (f *Factory) SetSamplingStrategy(strategy SamplingStrategy) error {
+	if f.sampler == nil {
+		return fmt.Errorf("tracer %s does not support sampling strategies", f.name)
+	}
+	return f.sampler.update(strategy)
+}
+
+// ReloadSampling reloads the sampling strategy from TracingOptions.SamplingSource now,
+// instead of waiting for the next refresh.
+func (f *Factory) ReloadSampling() error {
+	if f.sampler == nil {
+		return fmt.Errorf("tracer %s does not support sampling strategies", f.name)
+	}
+	return f.sampler.reload()
 }
 
 func GetTracer() *Factory {
-	return tracerFactory
+	return tracerFactory.Load().(*Factory)
 }
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Inject writes the span context of span, with its baggage, to the headers of an outgoing
+// request, in the formats of TracingOptions.Propagators, or of the tracer backend.
+func Inject(span *Span, header http.Header) error {
+	if span == nil {
+		return nil
+	}
+	return GetTracer().inject(span.Span.Context(), header)
+}
+
+// InjectContext writes the span context of the span carried by ctx to the headers, if any.
+func InjectContext(ctx context.Context, header http.Header) error {
+	if ctx == nil {
+		return nil
+	}
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return GetTracer().inject(span.Context(), header)
+}
+
+// Extract returns the span context in the headers of an incoming request, or
+// opentracing.ErrSpanContextNotFound if the headers carry none.
+func Extract(header http.Header) (opentracing.SpanContext, error) {
+	return GetTracer().extract(header)
+}
+
+// StartServerSpan starts a server span of an incoming request, child of the span context in
+// its headers, or a new trace if the headers carry none.
+func StartServerSpan(ctx context.Context, spanName string, header http.Header) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var option opentracing.StartSpanOption = ext.SpanKindRPCServer
+	wireContext, err := Extract(header)
+	if err == nil && wireContext != nil {
+		option = ext.RPCServerOption(wireContext)
+	}
+	s := opentracing.StartSpan(spanName, option)
+	ctxOut := opentracing.ContextWithSpan(ctx, s)
+	span := &Span{
+		s,
+		ctxOut,
+	}
+	if GetTracer().SampleAllSpans {
+		span.SetSamplingPriority(1)
+	}
+	return ctxOut, span
+}
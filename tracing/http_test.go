@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectExtract(t *testing.T) {
+	recorder := InitTracingForTest()
+	defer InitTracingForTest()
+
+	ctx, client := StartSpan(context.Background(), "client")
+	client.SetBaggage("tenant", "acme")
+	header := http.Header{}
+	require.NoError(t, Inject(client, header))
+	assert.NotEmpty(t, header)
+
+	fromContext := http.Header{}
+	require.NoError(t, InjectContext(ctx, fromContext))
+	assert.Equal(t, header, fromContext)
+
+	wireContext, err := Extract(header)
+	require.NoError(t, err)
+	assert.Equal(t, client.TraceID(), traceID(wireContext))
+	baggage := make(map[string]string)
+	wireContext.ForeachBaggageItem(func(k, v string) bool {
+		baggage[k] = v
+		return true
+	})
+	assert.Equal(t, map[string]string{"tenant": "acme"}, baggage)
+
+	_, server := StartServerSpan(context.Background(), "server", header)
+	server.Finish()
+	client.Finish()
+
+	servers := recorder.FindByName("server")
+	require.Len(t, servers, 1)
+	assert.EqualValues(t, "server", servers[0].Tag("span.kind"))
+	assert.Equal(t, recorder.FindByName("client")[0], recorder.Parent(servers[0]))
+}
+
+func TestStartServerSpanWithoutHeaders(t *testing.T) {
+	recorder := InitTracingForTest()
+	defer InitTracingForTest()
+
+	_, err := Extract(http.Header{})
+	assert.Equal(t, opentracing.ErrSpanContextNotFound, err)
+
+	ctx, server := StartServerSpan(nil, "server", http.Header{})
+	assert.Equal(t, server.Span, opentracing.SpanFromContext(ctx))
+	server.Finish()
+	assert.Len(t, recorder.Roots(), 1)
+
+	assert.NoError(t, Inject(nil, http.Header{}))
+	assert.NoError(t, InjectContext(context.Background(), http.Header{}))
+}
@@ -1,29 +1,64 @@
 package tracing
 
-//
-//import (
-//	"fmt"
-//	"io"
-//
-//	opentracing "github.com/opentracing/opentracing-go"
-//	jaeger "github.com/uber/jaeger-client-go"
-//	config "github.com/uber/jaeger-client-go/config"
-//)
-//
-//// Init returns an instance of Jaeger Tracer that samples 100% of traces and logs all spans to stdout.
-//func jeagerInit(service string) (opentracing.Tracer, io.Closer) {
-//	cfg := &config.Configuration{
-//		Sampler: &config.SamplerConfig{
-//			Type:  "const",
-//			Param: 1,
-//		},
-//		Reporter: &config.ReporterConfig{
-//			LogSpans: true,
-//		},
-//	}
-//	tracer, closer, err := cfg.New(service, config.Logger(jaeger.StdLogger))
-//	if err != nil {
-//		panic(fmt.Sprintf("ERROR: cannot init Jaeger: %v\n", err))
-//	}
-//	return tracer, closer
-//}
+import (
+	"fmt"
+	"io"
+
+	"github.com/opentracing/opentracing-go"
+	jaeger "github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/config"
+)
+
+// InitJaeger returns a Jaeger tracer reporting to the HTTP collector at ops.CollectorEndpoint,
+// or if not set to the UDP agent at ops.ReportHostPort.
+func InitJaeger(ops TracingOptions, serviceName string) (opentracing.Tracer, io.Closer, error) {
+	s, err := newSampler(serviceName, ops)
+	if err != nil {
+		return nil, nil, err
+	}
+	return initJaeger(ops, serviceName, s, &spanStats{})
+}
+
+func initJaeger(ops TracingOptions, serviceName string, s *sampler, stats *spanStats) (opentracing.Tracer, io.Closer, error) {
+	cfg := &config.Configuration{
+		ServiceName: serviceName,
+		Reporter: &config.ReporterConfig{
+			LogSpans:            ops.Debug,
+			LocalAgentHostPort:  ops.ReportHostPort,
+			CollectorEndpoint:   ops.CollectorEndpoint,
+			User:                ops.CollectorUser,
+			Password:            ops.CollectorPassword,
+			BufferFlushInterval: ops.FlushInterval,
+		},
+	}
+	options := []config.Option{config.Sampler(jaegerSampler{s}), config.Metrics(jaegerStats{stats})}
+	if ops.Debug {
+		options = append(options, config.Logger(jaeger.StdLogger))
+	}
+	t, closer, err := cfg.NewTracer(options...)
+	if err != nil {
+		fmt.Printf("unable to create Jaeger tracer: %+v\n", err)
+		return nil, nil, err
+	}
+
+	// explicitly set our tracer to be the default tracer.
+	opentracing.SetGlobalTracer(t)
+
+	return t, closer, nil
+}
+
+// jaegerSampler adapts sampler to the Jaeger tracer, which only asks for root spans.
+type jaegerSampler struct {
+	*sampler
+}
+
+func (s jaegerSampler) IsSampled(id jaeger.TraceID, operation string) (bool, []jaeger.Tag) {
+	return s.isSampled(TraceID{High: id.High, Low: id.Low}, operation), nil
+}
+
+func (s jaegerSampler) Close() {}
+
+func (s jaegerSampler) Equal(other jaeger.Sampler) bool {
+	o, ok := other.(jaegerSampler)
+	return ok && o.sampler == s.sampler
+}
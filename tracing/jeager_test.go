@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jaeger "github.com/uber/jaeger-client-go"
+)
+
+func TestJaegerUDPAgent(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = InitTracing("udp-service", TracingOptions{
+		Tracer:         TracerJaeger,
+		ReportHostPort: conn.LocalAddr().String(),
+	})
+	require.NoError(t, err)
+	_, span := StartSpan(context.Background(), "udp-operation")
+	span.SetHTTPUrl("/orders")
+	traceID := span.TraceID()
+	span.Finish()
+	CloseTracing(context.Background())
+
+	assert.Len(t, traceID, 16)
+	buf := make([]byte, 65000)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf[:n]), "udp-service")
+	assert.Contains(t, string(buf[:n]), "udp-operation")
+	assert.Contains(t, string(buf[:n]), "/orders")
+}
+
+func TestJaegerHTTPCollector(t *testing.T) {
+	batches := make(chan []byte, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "secret", password)
+		assert.Equal(t, "application/x-thrift", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		batches <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer collector.Close()
+
+	err := InitTracing("http-service", TracingOptions{
+		Tracer:            TracerJaeger,
+		CollectorEndpoint: collector.URL + "/api/traces",
+		CollectorUser:     "user",
+		CollectorPassword: "secret",
+	})
+	require.NoError(t, err)
+	_, span := StartSpan(context.Background(), "http-operation")
+	span.Finish()
+	CloseTracing(context.Background())
+
+	select {
+	case body := <-batches:
+		assert.Contains(t, string(body), "http-service")
+		assert.Contains(t, string(body), "http-operation")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch was received")
+	}
+}
+
+func TestJaegerTraceID(t *testing.T) {
+	sc := jaeger.NewSpanContext(jaeger.TraceID{Low: 0xabc}, 1, 0, true, nil)
+	assert.Equal(t, "0000000000000abc", traceID(sc))
+	sc = jaeger.NewSpanContext(jaeger.TraceID{High: 1, Low: 0xabc}, 1, 0, true, nil)
+	assert.Equal(t, "00000000000000010000000000000abc", traceID(sc))
+}
+
+func TestJaegerSamplers(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sampled := func(ops TracingOptions) []bool {
+		ops.Tracer = TracerJaeger
+		ops.ReportHostPort = conn.LocalAddr().String()
+		require.NoError(t, InitTracing("sampled", ops))
+		defer CloseTracing(context.Background())
+		var ret []bool
+		for i := 0; i < 3; i++ {
+			_, span := StartSpan(context.Background(), "operation")
+			ret = append(ret, span.Span.Context().(jaeger.SpanContext).IsSampled())
+			span.Finish()
+		}
+		return ret
+	}
+
+	assert.Equal(t, []bool{true, true, true}, sampled(TracingOptions{}))
+	assert.Equal(t, []bool{false, false, false}, sampled(TracingOptions{SamplerType: SamplerConst, SamplerParam: 0}))
+	assert.Equal(t, []bool{false, false, false}, sampled(TracingOptions{SamplerType: SamplerProbabilistic, SamplerParam: 0}))
+	assert.Equal(t, []bool{true, true, true}, sampled(TracingOptions{SamplerType: SamplerProbabilistic, SamplerParam: 1}))
+	assert.Equal(t, []bool{true, false, false}, sampled(TracingOptions{SamplerType: SamplerRateLimiting, SamplerParam: 1}))
+}
+
+func TestInitTracingErrors(t *testing.T) {
+	assert.EqualError(t, InitTracing("service", TracingOptions{Tracer: "unknown"}), `unknown tracer "unknown"`)
+	assert.EqualError(t, InitTracing("service", TracingOptions{Tracer: TracerJaeger, SamplerType: "remote"}),
+		`unknown sampler type "remote"`)
+}
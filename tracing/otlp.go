@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel/attribute"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otlpInstrumentationName is the name of the OpenTelemetry tracer bridged to OpenTracing.
+const otlpInstrumentationName = "github.com/liornabat/golibs/tracing"
+
+// InitOTLP returns an OpenTracing tracer bridged to an OpenTelemetry tracer provider, which
+// exports its spans to the OTLP collector at ops.ReportHostPort over ops.OTLPProtocol.
+// Tags become span attributes, logs become span events and baggage is kept in the span
+// context, so Span works as it does with the other backends.
+func InitOTLP(ops TracingOptions, serviceName string) (opentracing.Tracer, io.Closer, error) {
+	s, err := newSampler(serviceName, ops)
+	if err != nil {
+		return nil, nil, err
+	}
+	return initOTLP(ops, serviceName, s, &spanStats{})
+}
+
+func initOTLP(ops TracingOptions, serviceName string, s *sampler, stats *spanStats) (opentracing.Tracer, io.Closer, error) {
+	exporter, err := otlpExporter(ops)
+	if err != nil {
+		fmt.Printf("unable to create OTLP exporter: %+v\n", err)
+		return nil, nil, err
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, nil, err
+	}
+	var batcherOptions []sdktrace.BatchSpanProcessorOption
+	if ops.FlushInterval > 0 {
+		batcherOptions = append(batcherOptions, sdktrace.WithBatchTimeout(ops.FlushInterval))
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(&otlpStatsExporter{SpanExporter: exporter, stats: stats}, batcherOptions...),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(otlpSampler{s})),
+	)
+
+	t, _ := otbridge.NewTracerPair(provider.Tracer(otlpInstrumentationName))
+	t.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if ops.Debug {
+		t.SetWarningHandler(func(msg string) {
+			fmt.Printf("OTLP tracer: %s", msg)
+		})
+	}
+
+	// explicitly set our tracer to be the default tracer.
+	opentracing.SetGlobalTracer(t)
+
+	return t, &otlpCloser{provider: provider}, nil
+}
+
+func otlpExporter(ops TracingOptions) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(ops.OTLPProtocol) {
+	case "", OTLPProtocolHTTP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(ops.ReportHostPort)}
+		if ops.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(ops.OTLPHeaders) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(ops.OTLPHeaders))
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	case OTLPProtocolGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(ops.ReportHostPort)}
+		if ops.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(ops.OTLPHeaders) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(ops.OTLPHeaders))
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	}
+	return nil, fmt.Errorf("unknown OTLP protocol %q", ops.OTLPProtocol)
+}
+
+// otlpSampler adapts sampler to the OpenTelemetry tracer provider, spans with a parent
+// follow the sampling decision of the parent.
+type otlpSampler struct {
+	*sampler
+}
+
+func (s otlpSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	id := TraceID{
+		High: binary.BigEndian.Uint64(p.TraceID[:8]),
+		Low:  binary.BigEndian.Uint64(p.TraceID[8:]),
+	}
+	decision := sdktrace.Drop
+	if s.isSampled(id, p.Name) {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s otlpSampler) Description() string {
+	strategy := s.strategy()
+	return fmt.Sprintf("StrategySampler{%s,%g,operations:%d}", strategy.Type, strategy.Param, len(strategy.Operations))
+}
+
+// otlpStatsExporter counts the exported spans in stats.
+type otlpStatsExporter struct {
+	sdktrace.SpanExporter
+	stats *spanStats
+}
+
+func (e *otlpStatsExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		atomic.AddInt64(&e.stats.failed, int64(len(spans)))
+	} else {
+		atomic.AddInt64(&e.stats.sent, int64(len(spans)))
+	}
+	return err
+}
+
+// otlpCloser exports the buffered spans and shuts down the tracer provider.
+type otlpCloser struct {
+	provider *sdktrace.TracerProvider
+}
+
+func (c *otlpCloser) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown gives up exporting the buffered spans when ctx is done.
+func (c *otlpCloser) Shutdown(ctx context.Context) error {
+	return c.provider.Shutdown(ctx)
+}
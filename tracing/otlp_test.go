@@ -0,0 +1,187 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpCollector is an in-process OTLP collector keeping the received spans.
+type otlpCollector struct {
+	collectortrace.UnimplementedTraceServiceServer
+	requests chan *collectortrace.ExportTraceServiceRequest
+}
+
+func newOTLPCollector() *otlpCollector {
+	return &otlpCollector{requests: make(chan *collectortrace.ExportTraceServiceRequest, 10)}
+}
+
+func (c *otlpCollector) Export(_ context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	c.requests <- req
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || r.URL.Path != "/v1/traces" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, _ := c.Export(r.Context(), req)
+	out, _ := proto.Marshal(resp)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(out)
+}
+
+// spans returns the spans received by the collector by name, with the service name of their resource.
+func (c *otlpCollector) spans(t *testing.T) (map[string]*tracepb.Span, string) {
+	spans := make(map[string]*tracepb.Span)
+	var service string
+	select {
+	case req := <-c.requests:
+		for _, rs := range req.GetResourceSpans() {
+			service = attributeValue(rs.GetResource().GetAttributes(), "service.name")
+			for _, ss := range rs.GetScopeSpans() {
+				for _, s := range ss.GetSpans() {
+					spans[s.GetName()] = s
+				}
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no spans were received")
+	}
+	return spans, service
+}
+
+func attributeValue(attributes []*commonpb.KeyValue, key string) string {
+	for _, kv := range attributes {
+		if kv.GetKey() == key {
+			return kv.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
+
+func traceSpans(t *testing.T) (traceID string) {
+	ctx, span := StartSpan(context.Background(), "parent")
+	span.SetHTTPUrl("/orders").
+		SetDBStatement("select * from orders").
+		SetBaggage("userId", "1111").
+		LogKV("event", "started")
+	_, child := StartSpan(ctx, "child")
+	child.SetTag("userId", child.GetBaggage("userId"))
+	child.Finish()
+	span.Finish()
+	return span.TraceID()
+}
+
+func assertOTLPSpans(t *testing.T, collector *otlpCollector, traceID string) {
+	spans, service := collector.spans(t)
+	assert.Equal(t, "otlp-service", service)
+	require.Len(t, spans, 2)
+	parent, child := spans["parent"], spans["child"]
+	require.NotNil(t, parent)
+	require.NotNil(t, child)
+
+	assert.Len(t, traceID, 32)
+	assert.Equal(t, traceID, hex.EncodeToString(parent.GetTraceId()))
+	assert.Equal(t, parent.GetTraceId(), child.GetTraceId())
+	assert.Equal(t, parent.GetSpanId(), child.GetParentSpanId())
+	assert.Equal(t, "/orders", attributeValue(parent.GetAttributes(), "http.url"))
+	assert.Equal(t, "select * from orders", attributeValue(parent.GetAttributes(), "db.statement"))
+	require.Len(t, parent.GetEvents(), 1)
+	assert.Equal(t, "started", attributeValue(parent.GetEvents()[0].GetAttributes(), "event"))
+	assert.Equal(t, "1111", attributeValue(child.GetAttributes(), "userId"))
+}
+
+func TestOTLPHTTP(t *testing.T) {
+	collector := newOTLPCollector()
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	err := InitTracing("otlp-service", TracingOptions{
+		Tracer:         TracerOTLP,
+		ReportHostPort: strings.TrimPrefix(server.URL, "http://"),
+		OTLPInsecure:   true,
+	})
+	require.NoError(t, err)
+	traceID := traceSpans(t)
+	CloseTracing(context.Background())
+
+	assertOTLPSpans(t, collector, traceID)
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	collector := newOTLPCollector()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(server, collector)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	err = InitTracing("otlp-service", TracingOptions{
+		Tracer:         TracerOTLP,
+		ReportHostPort: listener.Addr().String(),
+		OTLPProtocol:   OTLPProtocolGRPC,
+		OTLPInsecure:   true,
+	})
+	require.NoError(t, err)
+	traceID := traceSpans(t)
+	CloseTracing(context.Background())
+
+	assertOTLPSpans(t, collector, traceID)
+}
+
+func TestOTLPSamplers(t *testing.T) {
+	collector := newOTLPCollector()
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	sampled := func(ops TracingOptions) []bool {
+		ops.Tracer = TracerOTLP
+		ops.ReportHostPort = strings.TrimPrefix(server.URL, "http://")
+		ops.OTLPInsecure = true
+		require.NoError(t, InitTracing("sampled", ops))
+		defer CloseTracing(context.Background())
+		var ret []bool
+		for i := 0; i < 3; i++ {
+			_, span := StartSpan(context.Background(), "operation")
+			ret = append(ret, span.Span.Context().(interface{ IsSampled() bool }).IsSampled())
+			span.Finish()
+		}
+		return ret
+	}
+
+	assert.Equal(t, []bool{true, true, true}, sampled(TracingOptions{}))
+	assert.Equal(t, []bool{false, false, false}, sampled(TracingOptions{SamplerType: SamplerConst, SamplerParam: 0}))
+	assert.Equal(t, []bool{false, false, false}, sampled(TracingOptions{SamplerType: SamplerProbabilistic, SamplerParam: 0}))
+	assert.Equal(t, []bool{true, true, true}, sampled(TracingOptions{SamplerType: SamplerProbabilistic, SamplerParam: 1}))
+	assert.Equal(t, []bool{true, false, false}, sampled(TracingOptions{SamplerType: SamplerRateLimiting, SamplerParam: 1}))
+}
+
+func TestOTLPErrors(t *testing.T) {
+	assert.EqualError(t, InitTracing("service", TracingOptions{Tracer: TracerOTLP, OTLPProtocol: "http/json"}),
+		`unknown OTLP protocol "http/json"`)
+	assert.EqualError(t, InitTracing("service", TracingOptions{Tracer: TracerOTLP, SamplerType: "remote"}),
+		`unknown sampler type "remote"`)
+}
@@ -0,0 +1,678 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// Names of the propagators of TracingOptions.Propagators and NewPropagator, as in the
+// OTEL_PROPAGATORS environment variable of OpenTelemetry.
+const (
+	PropagatorW3C      = "tracecontext"
+	PropagatorB3       = "b3multi"
+	PropagatorB3Single = "b3"
+	PropagatorJaeger   = "jaeger"
+)
+
+// TraceID is a 128-bit trace ID, High is zero for 64-bit trace IDs.
+type TraceID struct {
+	High, Low uint64
+}
+
+// IsValid returns true if the trace ID is not zero.
+func (t TraceID) IsValid() bool {
+	return t.High != 0 || t.Low != 0
+}
+
+// String returns the trace ID in 32 hex digits, or 16 for 64-bit trace IDs.
+func (t TraceID) String() string {
+	if t.High == 0 {
+		return fmt.Sprintf("%016x", t.Low)
+	}
+	return fmt.Sprintf("%016x%016x", t.High, t.Low)
+}
+
+// parseTraceID parses up to 32 hex digits.
+func parseTraceID(s string) (TraceID, error) {
+	var t TraceID
+	var err error
+	if len(s) == 0 || len(s) > 32 {
+		return t, opentracing.ErrSpanContextCorrupted
+	}
+	if len(s) > 16 {
+		if t.High, err = strconv.ParseUint(s[:len(s)-16], 16, 64); err != nil {
+			return t, opentracing.ErrSpanContextCorrupted
+		}
+		s = s[len(s)-16:]
+	}
+	if t.Low, err = strconv.ParseUint(s, 16, 64); err != nil {
+		return t, opentracing.ErrSpanContextCorrupted
+	}
+	return t, nil
+}
+
+// parseSpanID parses up to 16 hex digits.
+func parseSpanID(s string) (uint64, error) {
+	if len(s) == 0 || len(s) > 16 {
+		return 0, opentracing.ErrSpanContextCorrupted
+	}
+	id, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, opentracing.ErrSpanContextCorrupted
+	}
+	return id, nil
+}
+
+// SpanContext is the span context exchanged by propagators, independent of the tracer backend.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  uint64
+	// ParentID is only propagated by B3 and Jaeger, zero if unknown.
+	ParentID uint64
+	Sampled  bool
+	// Debug forces the sampling of the trace.
+	Debug bool
+	// TraceState is the W3C tracestate header, vendor data passed through unchanged.
+	TraceState string
+	Baggage    map[string]string
+}
+
+// IsValid returns true if the trace and span IDs are not zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID != 0
+}
+
+func (sc SpanContext) sampled() bool {
+	return sc.Sampled || sc.Debug
+}
+
+// Propagator reads and writes span contexts in a header format. Extract returns
+// opentracing.ErrSpanContextNotFound if the carrier holds no span context of the format,
+// and opentracing.ErrSpanContextCorrupted if it is malformed.
+type Propagator interface {
+	Inject(sc SpanContext, carrier opentracing.TextMapWriter)
+	Extract(carrier opentracing.TextMapReader) (SpanContext, error)
+}
+
+// NewPropagator returns the propagator of the names, a CompositePropagator if more than one.
+func NewPropagator(names ...string) (Propagator, error) {
+	var propagators []Propagator
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case PropagatorW3C:
+			propagators = append(propagators, W3CPropagator{})
+		case PropagatorB3:
+			propagators = append(propagators, B3Propagator{})
+		case PropagatorB3Single:
+			propagators = append(propagators, B3SingleHeaderPropagator{})
+		case PropagatorJaeger:
+			propagators = append(propagators, JaegerPropagator{})
+		default:
+			return nil, fmt.Errorf("unknown propagator %q", name)
+		}
+	}
+	if len(propagators) == 1 {
+		return propagators[0], nil
+	}
+	return NewCompositePropagator(propagators...), nil
+}
+
+// CompositePropagator injects the span context in the formats of all its propagators, and
+// extracts it with the first of its propagators that finds one.
+type CompositePropagator struct {
+	propagators []Propagator
+}
+
+func NewCompositePropagator(propagators ...Propagator) *CompositePropagator {
+	return &CompositePropagator{propagators: propagators}
+}
+
+func (c *CompositePropagator) Inject(sc SpanContext, carrier opentracing.TextMapWriter) {
+	for _, p := range c.propagators {
+		p.Inject(sc, carrier)
+	}
+}
+
+// Extract returns the first span context found, or the first corrupted error if none was found.
+func (c *CompositePropagator) Extract(carrier opentracing.TextMapReader) (SpanContext, error) {
+	err := opentracing.ErrSpanContextNotFound
+	for _, p := range c.propagators {
+		sc, e := p.Extract(carrier)
+		if e == nil {
+			return sc, nil
+		}
+		if err == opentracing.ErrSpanContextNotFound {
+			err = e
+		}
+	}
+	return SpanContext{}, err
+}
+
+// readCarrier returns the values of the carrier by lower case key, as header names are
+// case insensitive.
+func readCarrier(carrier opentracing.TextMapReader) (map[string]string, error) {
+	values := make(map[string]string)
+	err := carrier.ForeachKey(func(key, val string) error {
+		values[strings.ToLower(key)] = val
+		return nil
+	})
+	return values, err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// W3C Trace Context, https://www.w3.org/TR/trace-context/, with the baggage of
+// https://www.w3.org/TR/baggage/.
+const (
+	w3cTraceParent = "traceparent"
+	w3cTraceState  = "tracestate"
+	w3cBaggage     = "baggage"
+)
+
+// W3CPropagator propagates the traceparent and tracestate headers of W3C Trace Context, and
+// the baggage header of W3C Baggage.
+type W3CPropagator struct{}
+
+func (W3CPropagator) Inject(sc SpanContext, carrier opentracing.TextMapWriter) {
+	if !sc.IsValid() {
+		return
+	}
+	flags := "00"
+	if sc.sampled() {
+		flags = "01"
+	}
+	carrier.Set(w3cTraceParent, fmt.Sprintf("00-%016x%016x-%016x-%s", sc.TraceID.High, sc.TraceID.Low, sc.SpanID, flags))
+	if sc.TraceState != "" {
+		carrier.Set(w3cTraceState, sc.TraceState)
+	}
+	if len(sc.Baggage) > 0 {
+		members := make([]string, 0, len(sc.Baggage))
+		for _, k := range sortedKeys(sc.Baggage) {
+			members = append(members, url.PathEscape(k)+"="+url.PathEscape(sc.Baggage[k]))
+		}
+		carrier.Set(w3cBaggage, strings.Join(members, ","))
+	}
+}
+
+func (W3CPropagator) Extract(carrier opentracing.TextMapReader) (SpanContext, error) {
+	values, err := readCarrier(carrier)
+	if err != nil {
+		return SpanContext{}, err
+	}
+	traceParent, ok := values[w3cTraceParent]
+	if !ok {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	sc, err := parseTraceParent(strings.TrimSpace(traceParent))
+	if err != nil {
+		return SpanContext{}, err
+	}
+	if traceState := strings.TrimSpace(values[w3cTraceState]); validTraceState(traceState) {
+		sc.TraceState = traceState
+	}
+	sc.Baggage = parseW3CBaggage(values[w3cBaggage])
+	return sc, nil
+}
+
+// parseTraceParent parses version-traceid-parentid-flags. Versions after 00 may append
+// fields, which are ignored, and version ff is invalid.
+func parseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" || version == "00" && len(parts) != 4 {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if len(traceID) != 32 || !isLowerHex(traceID) || len(spanID) != 16 || !isLowerHex(spanID) ||
+		len(flags) != 2 || !isLowerHex(flags) {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	sc.TraceID, _ = parseTraceID(traceID)
+	sc.SpanID, _ = parseSpanID(spanID)
+	if !sc.IsValid() {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	sc.Sampled = f&1 == 1
+	return sc, nil
+}
+
+// validTraceState checks the list of up to 32 key=value members of a tracestate header.
+func validTraceState(s string) bool {
+	if s == "" {
+		return false
+	}
+	members := strings.Split(s, ",")
+	if len(members) > 32 {
+		return false
+	}
+	keys := make(map[string]bool)
+	for _, m := range members {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		i := strings.IndexByte(m, '=')
+		if i <= 0 || i == len(m)-1 || keys[m[:i]] {
+			return false
+		}
+		keys[m[:i]] = true
+	}
+	return true
+}
+
+// parseW3CBaggage parses the list of key=value;properties members of a baggage header,
+// properties and invalid members are dropped.
+func parseW3CBaggage(s string) map[string]string {
+	var baggage map[string]string
+	for _, m := range strings.Split(s, ",") {
+		if i := strings.IndexByte(m, ';'); i >= 0 {
+			m = m[:i]
+		}
+		i := strings.IndexByte(m, '=')
+		if i < 0 {
+			continue
+		}
+		k, err := url.PathUnescape(strings.TrimSpace(m[:i]))
+		if err != nil || k == "" {
+			continue
+		}
+		v, err := url.PathUnescape(strings.TrimSpace(m[i+1:]))
+		if err != nil {
+			continue
+		}
+		if baggage == nil {
+			baggage = make(map[string]string)
+		}
+		baggage[k] = v
+	}
+	return baggage
+}
+
+// B3, https://github.com/openzipkin/b3-propagation, with the baggage headers of the
+// Zipkin OpenTracing tracer.
+const (
+	b3TraceID       = "x-b3-traceid"
+	b3SpanID        = "x-b3-spanid"
+	b3ParentSpanID  = "x-b3-parentspanid"
+	b3Sampled       = "x-b3-sampled"
+	b3Flags         = "x-b3-flags"
+	b3Single        = "b3"
+	b3BaggagePrefix = "ot-baggage-"
+)
+
+// B3Propagator propagates the X-B3-* headers of B3 multiple headers.
+type B3Propagator struct{}
+
+func (B3Propagator) Inject(sc SpanContext, carrier opentracing.TextMapWriter) {
+	if !sc.IsValid() {
+		return
+	}
+	carrier.Set(b3TraceID, sc.TraceID.String())
+	carrier.Set(b3SpanID, fmt.Sprintf("%016x", sc.SpanID))
+	if sc.ParentID != 0 {
+		carrier.Set(b3ParentSpanID, fmt.Sprintf("%016x", sc.ParentID))
+	}
+	// debug implies sampling, and is not sent with the sampling state
+	switch {
+	case sc.Debug:
+		carrier.Set(b3Flags, "1")
+	case sc.Sampled:
+		carrier.Set(b3Sampled, "1")
+	default:
+		carrier.Set(b3Sampled, "0")
+	}
+	injectB3Baggage(sc, carrier)
+}
+
+func (B3Propagator) Extract(carrier opentracing.TextMapReader) (SpanContext, error) {
+	var sc SpanContext
+	values, err := readCarrier(carrier)
+	if err != nil {
+		return sc, err
+	}
+	traceID, hasTraceID := values[b3TraceID]
+	spanID, hasSpanID := values[b3SpanID]
+	if !hasTraceID && !hasSpanID {
+		return sc, opentracing.ErrSpanContextNotFound
+	}
+	if sc.TraceID, err = parseB3TraceID(traceID); err != nil {
+		return sc, err
+	}
+	if sc.SpanID, err = parseB3SpanID(spanID); err != nil {
+		return sc, err
+	}
+	if parentID, ok := values[b3ParentSpanID]; ok {
+		if sc.ParentID, err = parseB3SpanID(parentID); err != nil {
+			return sc, err
+		}
+	}
+	// an absent sampling state defers the decision, which is not sampled in SpanContext
+	switch values[b3Sampled] {
+	case "":
+	case "1", "true":
+		sc.Sampled = true
+	case "0", "false":
+		sc.Sampled = false
+	default:
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	switch values[b3Flags] {
+	case "", "0":
+	case "1":
+		sc.Debug = true
+	default:
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	sc.Baggage = extractPrefixedBaggage(values, b3BaggagePrefix, false)
+	return sc, nil
+}
+
+// B3SingleHeaderPropagator propagates the b3 header of B3 single header, as
+// {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}.
+type B3SingleHeaderPropagator struct{}
+
+func (B3SingleHeaderPropagator) Inject(sc SpanContext, carrier opentracing.TextMapWriter) {
+	if !sc.IsValid() {
+		return
+	}
+	state := "0"
+	switch {
+	case sc.Debug:
+		state = "d"
+	case sc.Sampled:
+		state = "1"
+	}
+	value := fmt.Sprintf("%s-%016x-%s", sc.TraceID, sc.SpanID, state)
+	if sc.ParentID != 0 {
+		value += fmt.Sprintf("-%016x", sc.ParentID)
+	}
+	carrier.Set(b3Single, value)
+	injectB3Baggage(sc, carrier)
+}
+
+// Extract returns opentracing.ErrSpanContextNotFound for a header holding only a sampling
+// state, e.g. "b3: 0", as there is no span context to continue.
+func (B3SingleHeaderPropagator) Extract(carrier opentracing.TextMapReader) (SpanContext, error) {
+	var sc SpanContext
+	values, err := readCarrier(carrier)
+	if err != nil {
+		return sc, err
+	}
+	value, ok := values[b3Single]
+	if !ok {
+		return sc, opentracing.ErrSpanContextNotFound
+	}
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) == 1 {
+		switch parts[0] {
+		case "0", "1", "d":
+			return sc, opentracing.ErrSpanContextNotFound
+		}
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if len(parts) > 4 {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if sc.TraceID, err = parseB3TraceID(parts[0]); err != nil {
+		return sc, err
+	}
+	if sc.SpanID, err = parseB3SpanID(parts[1]); err != nil {
+		return sc, err
+	}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1":
+			sc.Sampled = true
+		case "0":
+		case "d":
+			sc.Debug = true
+		default:
+			return sc, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	if len(parts) > 3 {
+		if sc.ParentID, err = parseB3SpanID(parts[3]); err != nil {
+			return sc, err
+		}
+	}
+	sc.Baggage = extractPrefixedBaggage(values, b3BaggagePrefix, false)
+	return sc, nil
+}
+
+// parseB3TraceID parses 16 or 32 lower hex digits.
+func parseB3TraceID(s string) (TraceID, error) {
+	if len(s) != 16 && len(s) != 32 || !isLowerHex(s) {
+		return TraceID{}, opentracing.ErrSpanContextCorrupted
+	}
+	t, err := parseTraceID(s)
+	if err == nil && !t.IsValid() {
+		err = opentracing.ErrSpanContextCorrupted
+	}
+	return t, err
+}
+
+// parseB3SpanID parses 16 lower hex digits.
+func parseB3SpanID(s string) (uint64, error) {
+	if len(s) != 16 || !isLowerHex(s) {
+		return 0, opentracing.ErrSpanContextCorrupted
+	}
+	id, err := parseSpanID(s)
+	if err == nil && id == 0 {
+		err = opentracing.ErrSpanContextCorrupted
+	}
+	return id, err
+}
+
+func injectB3Baggage(sc SpanContext, carrier opentracing.TextMapWriter) {
+	for _, k := range sortedKeys(sc.Baggage) {
+		carrier.Set(b3BaggagePrefix+k, sc.Baggage[k])
+	}
+}
+
+// extractPrefixedBaggage returns the baggage of the keys with the prefix.
+func extractPrefixedBaggage(values map[string]string, prefix string, unescape bool) map[string]string {
+	var baggage map[string]string
+	for k, v := range values {
+		if !strings.HasPrefix(k, prefix) || len(k) == len(prefix) {
+			continue
+		}
+		if unescape {
+			var err error
+			if v, err = url.QueryUnescape(v); err != nil {
+				continue
+			}
+		}
+		if baggage == nil {
+			baggage = make(map[string]string)
+		}
+		baggage[strings.TrimPrefix(k, prefix)] = v
+	}
+	return baggage
+}
+
+// Jaeger, https://www.jaegertracing.io/docs/client-libraries/#propagation-format.
+const (
+	jaegerTraceContext  = "uber-trace-id"
+	jaegerBaggagePrefix = "uberctx-"
+
+	jaegerFlagSampled = 1
+	jaegerFlagDebug   = 2
+)
+
+// JaegerPropagator propagates the uber-trace-id header, as
+// {trace-id}:{span-id}:{parent-span-id}:{flags}, and the uberctx-* baggage headers.
+type JaegerPropagator struct{}
+
+func (JaegerPropagator) Inject(sc SpanContext, carrier opentracing.TextMapWriter) {
+	if !sc.IsValid() {
+		return
+	}
+	var flags byte
+	if sc.sampled() {
+		flags |= jaegerFlagSampled
+	}
+	if sc.Debug {
+		flags |= jaegerFlagDebug
+	}
+	carrier.Set(jaegerTraceContext, fmt.Sprintf("%s:%016x:%x:%x", sc.TraceID, sc.SpanID, sc.ParentID, flags))
+	for _, k := range sortedKeys(sc.Baggage) {
+		carrier.Set(jaegerBaggagePrefix+k, url.QueryEscape(sc.Baggage[k]))
+	}
+}
+
+// Extract accepts the URL encoded values written by Jaeger clients to HTTP headers.
+func (JaegerPropagator) Extract(carrier opentracing.TextMapReader) (SpanContext, error) {
+	var sc SpanContext
+	values, err := readCarrier(carrier)
+	if err != nil {
+		return sc, err
+	}
+	value, ok := values[jaegerTraceContext]
+	if !ok {
+		return sc, opentracing.ErrSpanContextNotFound
+	}
+	if value, err = url.QueryUnescape(value); err != nil {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 4 {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if sc.TraceID, err = parseTraceID(parts[0]); err != nil {
+		return sc, err
+	}
+	if sc.SpanID, err = parseSpanID(parts[1]); err != nil {
+		return sc, err
+	}
+	if sc.ParentID, err = parseSpanID(parts[2]); err != nil {
+		return sc, err
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if !sc.IsValid() {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	sc.Sampled = flags&jaegerFlagSampled != 0
+	sc.Debug = flags&jaegerFlagDebug != 0
+	sc.Baggage = extractPrefixedBaggage(values, jaegerBaggagePrefix, true)
+	return sc, nil
+}
+
+// traceStateBaggage is the baggage item carrying the W3C tracestate through the native
+// formats of the tracers without a tracestate, i.e. Zipkin and Jaeger, so that it is kept
+// by the spans of the trace and injected again.
+const traceStateBaggage = "w3c-tracestate"
+
+// spanContextOf returns the span context of the tracer as a SpanContext, by injecting it in
+// the native headers of the tracer and extracting them with the native propagator.
+func (f *Factory) spanContextOf(sc opentracing.SpanContext) (SpanContext, error) {
+	if f.native == nil {
+		return SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	header := http.Header{}
+	if err := f.Tracer.Inject(sc, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != nil {
+		return SpanContext{}, err
+	}
+	spanContext, err := f.native.Extract(opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		return spanContext, err
+	}
+	if traceState, ok := spanContext.Baggage[traceStateBaggage]; ok {
+		delete(spanContext.Baggage, traceStateBaggage)
+		if len(spanContext.Baggage) == 0 {
+			spanContext.Baggage = nil
+		}
+		if spanContext.TraceState == "" {
+			spanContext.TraceState = traceState
+		}
+	}
+	return spanContext, nil
+}
+
+// tracerSpanContext returns the span context of the tracer of a SpanContext. Without a
+// native propagator, e.g. for the no-op tracer, the tracer extracts empty headers.
+func (f *Factory) tracerSpanContext(sc SpanContext) (opentracing.SpanContext, error) {
+	header := http.Header{}
+	if f.native != nil {
+		if _, w3c := f.native.(W3CPropagator); !w3c && sc.TraceState != "" {
+			baggage := make(map[string]string, len(sc.Baggage)+1)
+			for k, v := range sc.Baggage {
+				baggage[k] = v
+			}
+			baggage[traceStateBaggage] = sc.TraceState
+			sc.Baggage = baggage
+		}
+		f.native.Inject(sc, opentracing.HTTPHeadersCarrier(header))
+	}
+	return f.Tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+}
+
+// SetPropagator sets the propagator of Inject and Extract, nil selects the native format of
+// the tracer backend.
+func (f *Factory) SetPropagator(p Propagator) *Factory {
+	f.mu.Lock()
+	f.propagator = p
+	f.mu.Unlock()
+	return f
+}
+
+func (f *Factory) getPropagator() Propagator {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.propagator
+}
+
+func (f *Factory) inject(sc opentracing.SpanContext, header http.Header) error {
+	carrier := opentracing.HTTPHeadersCarrier(header)
+	propagator := f.getPropagator()
+	if propagator == nil {
+		return f.Tracer.Inject(sc, opentracing.HTTPHeaders, carrier)
+	}
+	spanContext, err := f.spanContextOf(sc)
+	if err != nil {
+		return err
+	}
+	propagator.Inject(spanContext, carrier)
+	return nil
+}
+
+func (f *Factory) extract(header http.Header) (opentracing.SpanContext, error) {
+	carrier := opentracing.HTTPHeadersCarrier(header)
+	propagator := f.getPropagator()
+	if propagator == nil {
+		return f.Tracer.Extract(opentracing.HTTPHeaders, carrier)
+	}
+	spanContext, err := propagator.Extract(carrier)
+	if err != nil {
+		return nil, err
+	}
+	return f.tracerSpanContext(spanContext)
+}
@@ -0,0 +1,325 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type extractCase struct {
+	name    string
+	headers map[string]string
+	want    SpanContext
+	err     error
+}
+
+func testExtract(t *testing.T, p Propagator, cases []extractCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range c.headers {
+				header.Set(k, v)
+			}
+			sc, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+			if c.err != nil {
+				assert.Equal(t, c.err, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, sc)
+		})
+	}
+}
+
+func injected(p Propagator, sc SpanContext) map[string]string {
+	carrier := opentracing.TextMapCarrier{}
+	p.Inject(sc, carrier)
+	return carrier
+}
+
+var (
+	traceID128 = TraceID{High: 0x4bf92f3577b34da6, Low: 0xa3ce929d0e0e4736}
+	traceID64  = TraceID{Low: 0x48485a3953bb6124}
+)
+
+func TestW3CPropagator(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sampled := SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7, Sampled: true}
+	notSampled := SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7}
+
+	testExtract(t, W3CPropagator{}, []extractCase{
+		{name: "sampled", headers: map[string]string{"traceparent": parent}, want: sampled},
+		{name: "not sampled", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}, want: notSampled},
+		{name: "unknown flags are ignored", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-09"}, want: sampled},
+		{name: "unknown flags without sampled", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-08"}, want: notSampled},
+		{name: "future version with more fields", headers: map[string]string{"traceparent": "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds"}, want: sampled},
+		{name: "tracestate", headers: map[string]string{"traceparent": parent, "tracestate": "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"},
+			want: SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7, Sampled: true, TraceState: "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"}},
+		{name: "invalid tracestate is dropped", headers: map[string]string{"traceparent": parent, "tracestate": "rojo"}, want: sampled},
+		{name: "duplicated tracestate keys are dropped", headers: map[string]string{"traceparent": parent, "tracestate": "rojo=1,rojo=2"}, want: sampled},
+		{name: "baggage", headers: map[string]string{"traceparent": parent, "baggage": "userId=alice%20smith,serverNode=DF%2028;prop=1, isProduction=false,invalid"},
+			want: SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7, Sampled: true,
+				Baggage: map[string]string{"userId": "alice smith", "serverNode": "DF 28", "isProduction": "false"}}},
+		{name: "missing", headers: map[string]string{"tracestate": "rojo=1"}, err: opentracing.ErrSpanContextNotFound},
+		{name: "version ff", headers: map[string]string{"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "version 00 with more fields", headers: map[string]string{"traceparent": parent + "-extra"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "short version", headers: map[string]string{"traceparent": "0-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "upper case", headers: map[string]string{"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero trace id", headers: map[string]string{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero span id", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "short trace id", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "not hex", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "short flags", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "missing fields", headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"}, err: opentracing.ErrSpanContextCorrupted},
+	})
+
+	assert.Equal(t, map[string]string{"traceparent": parent}, injected(W3CPropagator{}, sampled))
+	assert.Equal(t, map[string]string{"traceparent": "00-000000000000000048485a3953bb6124-00f067aa0ba902b7-01"},
+		injected(W3CPropagator{}, SpanContext{TraceID: traceID64, SpanID: 0x00f067aa0ba902b7, Debug: true}))
+	assert.Equal(t, map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		"tracestate":  "rojo=1",
+		"baggage":     "a=1,b=x%2Cy%20z",
+	}, injected(W3CPropagator{}, SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7, TraceState: "rojo=1",
+		Baggage: map[string]string{"b": "x,y z", "a": "1"}}))
+	assert.Empty(t, injected(W3CPropagator{}, SpanContext{}))
+}
+
+func TestB3Propagator(t *testing.T) {
+	full := SpanContext{TraceID: traceID128, SpanID: 0xa2fb4a1d1a96d312, ParentID: 0x0020000000000001, Sampled: true}
+
+	testExtract(t, B3Propagator{}, []extractCase{
+		{name: "128 bit", headers: map[string]string{
+			"X-B3-TraceId": "4bf92f3577b34da6a3ce929d0e0e4736", "X-B3-SpanId": "a2fb4a1d1a96d312",
+			"X-B3-ParentSpanId": "0020000000000001", "X-B3-Sampled": "1"}, want: full},
+		{name: "64 bit", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-Sampled": "0"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xa2fb4a1d1a96d312}},
+		{name: "deferred", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xa2fb4a1d1a96d312}},
+		{name: "legacy sampled", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-Sampled": "true"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xa2fb4a1d1a96d312, Sampled: true}},
+		{name: "debug", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-Flags": "1"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xa2fb4a1d1a96d312, Debug: true}},
+		{name: "baggage", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "Ot-Baggage-User": "alice"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xa2fb4a1d1a96d312, Baggage: map[string]string{"user": "alice"}}},
+		{name: "missing", headers: map[string]string{"X-B3-Sampled": "1"}, err: opentracing.ErrSpanContextNotFound},
+		{name: "missing span id", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "short trace id", headers: map[string]string{"X-B3-TraceId": "8485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero trace id", headers: map[string]string{"X-B3-TraceId": "0000000000000000", "X-B3-SpanId": "a2fb4a1d1a96d312"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "invalid parent", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-ParentSpanId": "x"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "invalid sampled", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-Sampled": "2"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "invalid flags", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-Flags": "2"}, err: opentracing.ErrSpanContextCorrupted},
+	})
+
+	assert.Equal(t, map[string]string{
+		"x-b3-traceid":      "4bf92f3577b34da6a3ce929d0e0e4736",
+		"x-b3-spanid":       "a2fb4a1d1a96d312",
+		"x-b3-parentspanid": "0020000000000001",
+		"x-b3-sampled":      "1",
+	}, injected(B3Propagator{}, full))
+	assert.Equal(t, map[string]string{
+		"x-b3-traceid":    "48485a3953bb6124",
+		"x-b3-spanid":     "a2fb4a1d1a96d312",
+		"x-b3-flags":      "1",
+		"ot-baggage-user": "alice",
+	}, injected(B3Propagator{}, SpanContext{TraceID: traceID64, SpanID: 0xa2fb4a1d1a96d312, Debug: true, Baggage: map[string]string{"user": "alice"}}))
+	assert.Equal(t, "0", injected(B3Propagator{}, SpanContext{TraceID: traceID64, SpanID: 1})["x-b3-sampled"])
+}
+
+func TestB3SingleHeaderPropagator(t *testing.T) {
+	full := SpanContext{TraceID: traceID128, SpanID: 0xe457b5a2e4d86bd1, ParentID: 0x05e3ac9a4f6e3b90, Sampled: true}
+
+	testExtract(t, B3SingleHeaderPropagator{}, []extractCase{
+		{name: "full", headers: map[string]string{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"}, want: full},
+		{name: "deferred", headers: map[string]string{"b3": "48485a3953bb6124-e457b5a2e4d86bd1"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xe457b5a2e4d86bd1}},
+		{name: "not sampled", headers: map[string]string{"b3": "48485a3953bb6124-e457b5a2e4d86bd1-0"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xe457b5a2e4d86bd1}},
+		{name: "debug", headers: map[string]string{"b3": "48485a3953bb6124-e457b5a2e4d86bd1-d"},
+			want: SpanContext{TraceID: traceID64, SpanID: 0xe457b5a2e4d86bd1, Debug: true}},
+		{name: "missing", headers: map[string]string{"X-B3-TraceId": "48485a3953bb6124"}, err: opentracing.ErrSpanContextNotFound},
+		{name: "deny only", headers: map[string]string{"b3": "0"}, err: opentracing.ErrSpanContextNotFound},
+		{name: "invalid sampling only", headers: map[string]string{"b3": "x"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "invalid sampling state", headers: map[string]string{"b3": "48485a3953bb6124-e457b5a2e4d86bd1-2"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "short span id", headers: map[string]string{"b3": "48485a3953bb6124-457b5a2e4d86bd1-1"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "too many fields", headers: map[string]string{"b3": "48485a3953bb6124-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90-1"}, err: opentracing.ErrSpanContextCorrupted},
+	})
+
+	assert.Equal(t, map[string]string{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+		injected(B3SingleHeaderPropagator{}, full))
+	assert.Equal(t, map[string]string{"b3": "48485a3953bb6124-e457b5a2e4d86bd1-d"},
+		injected(B3SingleHeaderPropagator{}, SpanContext{TraceID: traceID64, SpanID: 0xe457b5a2e4d86bd1, Sampled: true, Debug: true}))
+	assert.Equal(t, map[string]string{"b3": "48485a3953bb6124-e457b5a2e4d86bd1-0"},
+		injected(B3SingleHeaderPropagator{}, SpanContext{TraceID: traceID64, SpanID: 0xe457b5a2e4d86bd1}))
+}
+
+func TestJaegerPropagator(t *testing.T) {
+	testExtract(t, JaegerPropagator{}, []extractCase{
+		{name: "128 bit", headers: map[string]string{"uber-trace-id": "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1"},
+			want: SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7, Sampled: true}},
+		{name: "unpadded", headers: map[string]string{"uber-trace-id": "abc:def:123:0"},
+			want: SpanContext{TraceID: TraceID{Low: 0xabc}, SpanID: 0xdef, ParentID: 0x123}},
+		{name: "debug", headers: map[string]string{"uber-trace-id": "abc:def:0:3"},
+			want: SpanContext{TraceID: TraceID{Low: 0xabc}, SpanID: 0xdef, Sampled: true, Debug: true}},
+		{name: "url encoded", headers: map[string]string{"uber-trace-id": "abc%3Adef%3A0%3A1"},
+			want: SpanContext{TraceID: TraceID{Low: 0xabc}, SpanID: 0xdef, Sampled: true}},
+		{name: "baggage", headers: map[string]string{"uber-trace-id": "abc:def:0:1", "uberctx-user": "alice+smith"},
+			want: SpanContext{TraceID: TraceID{Low: 0xabc}, SpanID: 0xdef, Sampled: true, Baggage: map[string]string{"user": "alice smith"}}},
+		{name: "missing", headers: map[string]string{"uberctx-user": "alice"}, err: opentracing.ErrSpanContextNotFound},
+		{name: "missing fields", headers: map[string]string{"uber-trace-id": "abc:def:1"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero trace id", headers: map[string]string{"uber-trace-id": "0:def:0:1"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "zero span id", headers: map[string]string{"uber-trace-id": "abc:0:0:1"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "long trace id", headers: map[string]string{"uber-trace-id": "14bf92f3577b34da6a3ce929d0e0e4736:def:0:1"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "invalid flags", headers: map[string]string{"uber-trace-id": "abc:def:0:zz"}, err: opentracing.ErrSpanContextCorrupted},
+	})
+
+	assert.Equal(t, map[string]string{
+		"uber-trace-id": "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1",
+		"uberctx-user":  "alice+smith",
+	}, injected(JaegerPropagator{}, SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7, Sampled: true,
+		Baggage: map[string]string{"user": "alice smith"}}))
+	assert.Equal(t, map[string]string{"uber-trace-id": "48485a3953bb6124:0000000000000def:abc:3"},
+		injected(JaegerPropagator{}, SpanContext{TraceID: traceID64, SpanID: 0xdef, ParentID: 0xabc, Debug: true}))
+}
+
+func TestCompositePropagator(t *testing.T) {
+	p, err := NewPropagator(PropagatorW3C, PropagatorB3Single)
+	require.NoError(t, err)
+	sc := SpanContext{TraceID: traceID128, SpanID: 0x00f067aa0ba902b7, Sampled: true}
+	assert.Equal(t, map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"b3":          "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	}, injected(p, sc))
+
+	testExtract(t, p, []extractCase{
+		{name: "first", headers: map[string]string{
+			"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"b3":          "48485a3953bb6124-e457b5a2e4d86bd1-1"}, want: sc},
+		{name: "second", headers: map[string]string{"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"}, want: sc},
+		{name: "second after corrupted", headers: map[string]string{
+			"traceparent": "00-zz-00f067aa0ba902b7-01",
+			"b3":          "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"}, want: sc},
+		{name: "corrupted", headers: map[string]string{"traceparent": "00-zz-00f067aa0ba902b7-01"}, err: opentracing.ErrSpanContextCorrupted},
+		{name: "missing", headers: map[string]string{"uber-trace-id": "abc:def:0:1"}, err: opentracing.ErrSpanContextNotFound},
+	})
+
+	_, err = NewPropagator(PropagatorW3C, "xray")
+	assert.EqualError(t, err, `unknown propagator "xray"`)
+}
+
+// forEachBackend runs test with every tracer backend, reporting to local stand-ins. init
+// initializes the tracer of the backend with the options.
+func forEachBackend(t *testing.T, test func(t *testing.T, init func(ops TracingOptions) error)) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	server := httptest.NewServer(newOTLPCollector())
+	defer server.Close()
+	zipkinServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer zipkinServer.Close()
+
+	t.Run(TracerZipkin, func(t *testing.T) {
+		test(t, func(ops TracingOptions) error {
+			ops.ReportHostPort = strings.TrimPrefix(zipkinServer.URL, "http://")
+			return InitTracing("backend", ops)
+		})
+	})
+	t.Run(TracerJaeger, func(t *testing.T) {
+		test(t, func(ops TracingOptions) error {
+			ops.Tracer = TracerJaeger
+			ops.ReportHostPort = conn.LocalAddr().String()
+			return InitTracing("backend", ops)
+		})
+	})
+	t.Run(TracerOTLP, func(t *testing.T) {
+		test(t, func(ops TracingOptions) error {
+			ops.Tracer = TracerOTLP
+			ops.ReportHostPort = strings.TrimPrefix(server.URL, "http://")
+			ops.OTLPInsecure = true
+			return InitTracing("backend", ops)
+		})
+	})
+}
+
+// TestBackendPropagation checks that a span context of every tracer backend survives
+// Inject and Extract in the W3C and B3 single header formats.
+func TestBackendPropagation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, init func(ops TracingOptions) error) {
+		for _, name := range []string{PropagatorW3C, PropagatorB3Single} {
+			t.Run(name, func(t *testing.T) {
+				require.NoError(t, init(TracingOptions{Propagators: []string{name}}))
+				defer CloseTracing(context.Background())
+				_, span := StartSpan(context.Background(), "client")
+				defer span.Finish()
+
+				header := http.Header{}
+				require.NoError(t, Inject(span, header))
+				p, err := NewPropagator(name)
+				require.NoError(t, err)
+				injectedContext, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+				require.NoError(t, err)
+				want, err := parseTraceID(span.TraceID())
+				require.NoError(t, err)
+				assert.Equal(t, want, injectedContext.TraceID)
+				assert.True(t, injectedContext.Sampled)
+
+				wireContext, err := Extract(header)
+				require.NoError(t, err)
+				got, err := parseTraceID(traceID(wireContext))
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+			})
+		}
+
+		t.Run("tracestate", func(t *testing.T) {
+			require.NoError(t, init(TracingOptions{Propagators: []string{PropagatorW3C}}))
+			defer CloseTracing(context.Background())
+			header := http.Header{}
+			header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+			header.Set("tracestate", "vendor=value,other=1")
+			ctx, server := StartServerSpan(context.Background(), "server", header)
+			defer server.Finish()
+			_, client := StartSpan(ctx, "client")
+			defer client.Finish()
+
+			out := http.Header{}
+			require.NoError(t, Inject(client, out))
+			assert.Equal(t, "vendor=value,other=1", out.Get("tracestate"))
+			assert.Empty(t, out.Get("baggage"))
+			assert.True(t, strings.HasPrefix(out.Get("traceparent"), "00-0af7651916cd43dd8448eb211c80319c-"))
+		})
+	})
+}
+
+func TestRecorderPropagation(t *testing.T) {
+	recorder := InitTracingForTest()
+	defer InitTracingForTest()
+	GetTracer().SetPropagator(W3CPropagator{})
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, server := StartServerSpan(context.Background(), "server", header)
+	out := http.Header{}
+	require.NoError(t, Inject(server, out))
+	server.Finish()
+
+	// the mock tracer keeps the low 63 bits of the IDs
+	spans := recorder.FindByName("server")
+	require.Len(t, spans, 1)
+	assert.Equal(t, 0x23ce929d0e0e4736, spans[0].SpanContext.TraceID)
+	assert.Equal(t, 0x00f067aa0ba902b7, spans[0].ParentID)
+	sc, err := W3CPropagator{}.Extract(opentracing.HTTPHeadersCarrier(out))
+	require.NoError(t, err)
+	assert.Equal(t, TraceID{Low: 0x23ce929d0e0e4736}, sc.TraceID)
+	assert.Equal(t, uint64(spans[0].SpanContext.SpanID), sc.SpanID)
+	assert.True(t, sc.Sampled)
+}
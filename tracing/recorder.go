@@ -0,0 +1,144 @@
+package tracing
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// SpanRecorder keeps in memory the spans finished since InitTracingForTest, with helpers
+// to find them in test assertions.
+type SpanRecorder struct {
+	*mocktracer.MockTracer
+}
+
+// InitTracingForTest sets a tracer that records the finished spans in memory instead of
+// reporting them, and returns its recorder.
+func InitTracingForTest() *SpanRecorder {
+	t := mocktracer.New()
+	// explicitly set our tracer to be the default tracer.
+	opentracing.SetGlobalTracer(t)
+	setTracerFactory(&Factory{
+		name:   "test",
+		Tracer: t,
+		cache:  newCache(),
+		closer: nopCloser{},
+		native: mockPropagator{},
+		stats:  &spanStats{},
+	})
+	return &SpanRecorder{t}
+}
+
+// Spans returns the finished spans in the order they finished.
+func (r *SpanRecorder) Spans() []*mocktracer.MockSpan {
+	return r.FinishedSpans()
+}
+
+// FindByName returns the finished spans of the operation name.
+func (r *SpanRecorder) FindByName(name string) []*mocktracer.MockSpan {
+	return r.find(func(s *mocktracer.MockSpan) bool {
+		return s.OperationName == name
+	})
+}
+
+// FindByTag returns the finished spans having the tag, see FindByTags.
+func (r *SpanRecorder) FindByTag(key string, value interface{}) []*mocktracer.MockSpan {
+	return r.FindByTags(map[string]interface{}{key: value})
+}
+
+// FindByTags returns the finished spans having all the tags. Values are compared by their
+// string representation, so uint16(200) matches 200.
+func (r *SpanRecorder) FindByTags(tags map[string]interface{}) []*mocktracer.MockSpan {
+	return r.find(func(s *mocktracer.MockSpan) bool {
+		spanTags := s.Tags()
+		for k, v := range tags {
+			value, ok := spanTags[k]
+			if !ok || fmt.Sprint(value) != fmt.Sprint(v) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Roots returns the finished spans without a parent.
+func (r *SpanRecorder) Roots() []*mocktracer.MockSpan {
+	return r.find(func(s *mocktracer.MockSpan) bool {
+		return s.ParentID == 0
+	})
+}
+
+// Children returns the finished spans whose parent is span.
+func (r *SpanRecorder) Children(span *mocktracer.MockSpan) []*mocktracer.MockSpan {
+	return r.find(func(s *mocktracer.MockSpan) bool {
+		return s.ParentID == span.SpanContext.SpanID
+	})
+}
+
+// Parent returns the parent of span, or nil if span is a root or its parent did not finish.
+func (r *SpanRecorder) Parent(span *mocktracer.MockSpan) *mocktracer.MockSpan {
+	if span.ParentID == 0 {
+		return nil
+	}
+	for _, s := range r.FinishedSpans() {
+		if s.SpanContext.SpanID == span.ParentID {
+			return s
+		}
+	}
+	return nil
+}
+
+func (r *SpanRecorder) find(match func(s *mocktracer.MockSpan) bool) []*mocktracer.MockSpan {
+	var ret []*mocktracer.MockSpan
+	for _, s := range r.FinishedSpans() {
+		if match(s) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// Headers of the mock tracer.
+const (
+	mockTraceID       = "mockpfx-ids-traceid"
+	mockSpanID        = "mockpfx-ids-spanid"
+	mockSampled       = "mockpfx-ids-sampled"
+	mockBaggagePrefix = "mockpfx-baggage-"
+)
+
+// mockPropagator is the native propagator of the mock tracer, which has int IDs, so only
+// the low 63 bits of the trace and span IDs of other formats are kept.
+type mockPropagator struct{}
+
+func (mockPropagator) Inject(sc SpanContext, carrier opentracing.TextMapWriter) {
+	carrier.Set(mockTraceID, strconv.FormatUint(sc.TraceID.Low&(1<<63-1), 10))
+	carrier.Set(mockSpanID, strconv.FormatUint(sc.SpanID&(1<<63-1), 10))
+	carrier.Set(mockSampled, strconv.FormatBool(sc.sampled()))
+	for k, v := range sc.Baggage {
+		carrier.Set(mockBaggagePrefix+k, v)
+	}
+}
+
+func (mockPropagator) Extract(carrier opentracing.TextMapReader) (SpanContext, error) {
+	var sc SpanContext
+	values, err := readCarrier(carrier)
+	if err != nil {
+		return sc, err
+	}
+	if _, ok := values[mockTraceID]; !ok {
+		return sc, opentracing.ErrSpanContextNotFound
+	}
+	if sc.TraceID.Low, err = strconv.ParseUint(values[mockTraceID], 10, 63); err != nil {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if sc.SpanID, err = strconv.ParseUint(values[mockSpanID], 10, 63); err != nil {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	if sc.Sampled, err = strconv.ParseBool(values[mockSampled]); err != nil {
+		return sc, opentracing.ErrSpanContextCorrupted
+	}
+	sc.Baggage = extractPrefixedBaggage(values, mockBaggagePrefix, false)
+	return sc, nil
+}
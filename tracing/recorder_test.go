@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoopTracerBeforeInit(t *testing.T) {
+	tracerFactory.Store(newNoopFactory())
+	opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	assert.NotPanics(t, func() {
+		ctx, span := StartSpan(nil, "noop")
+		span.SetHTTPUrl("/orders").SetBaggage("userId", "1111").Log("message")
+		_, child := StartSpan(ctx, "child")
+		child.StoreSpanToCache("key").Finish()
+		_, cached := StartSpanFromCache("cached", "key")
+		require.NotNil(t, cached)
+		cached.Finish()
+		span.Finish()
+		assert.Equal(t, "", span.TraceID())
+		require.NoError(t, GetTracer().Close())
+	})
+}
+
+func TestInitTracingForTest(t *testing.T) {
+	recorder := InitTracingForTest()
+	defer InitTracingForTest()
+
+	ctx, root := StartSpan(context.Background(), "root")
+	root.SetHTTPMethod("GET").SetHTTPStatusCode(200)
+	_, first := StartSpan(ctx, "child")
+	first.SetDBType("sql").Finish()
+	_, second := StartSpan(ctx, "child")
+	second.SetDBType("cql").Finish()
+	root.Finish()
+
+	assert.NotEmpty(t, root.TraceID())
+	require.Len(t, recorder.Spans(), 3)
+	assert.Len(t, recorder.FindByName("child"), 2)
+	assert.Empty(t, recorder.FindByName("unknown"))
+
+	roots := recorder.Roots()
+	require.Len(t, roots, 1)
+	assert.Equal(t, "root", roots[0].OperationName)
+	assert.Equal(t, fmt.Sprintf("%016x", roots[0].SpanContext.TraceID), root.TraceID())
+	assert.Equal(t, roots, recorder.FindByTag("http.status_code", 200))
+	assert.Equal(t, roots, recorder.FindByTags(map[string]interface{}{"http.method": "GET", "http.status_code": "200"}))
+	assert.Empty(t, recorder.FindByTags(map[string]interface{}{"http.method": "GET", "http.status_code": 500}))
+	assert.Nil(t, recorder.Parent(roots[0]))
+
+	children := recorder.Children(roots[0])
+	require.Len(t, children, 2)
+	assert.Equal(t, "sql", children[0].Tag("db.type"))
+	assert.Equal(t, "cql", children[1].Tag("db.type"))
+	assert.Equal(t, roots[0], recorder.Parent(children[1]))
+	assert.Equal(t, children[1:], recorder.FindByTag("db.type", "cql"))
+
+	recorder.Reset()
+	assert.Empty(t, recorder.Spans())
+}
@@ -0,0 +1,277 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liornabat/golibs/logging"
+	"github.com/uber/jaeger-client-go/utils"
+)
+
+// SamplingStrategy decides which traces are sampled. It is encoded in JSON like a strategy
+// of the strategies file of the Jaeger collector, e.g.
+//
+//	{
+//	  "type": "probabilistic",
+//	  "param": 0.1,
+//	  "operation_strategies": [{"operation": "GET /health", "type": "probabilistic", "param": 0}]
+//	}
+type SamplingStrategy struct {
+	// Type is SamplerConst, SamplerProbabilistic or SamplerRateLimiting, see SamplerType.
+	Type  string  `json:"type"`
+	Param float64 `json:"param"`
+	// Operations override the strategy for the traces started by the operations.
+	Operations []OperationStrategy `json:"operation_strategies,omitempty"`
+}
+
+// OperationStrategy is the strategy of the traces started by an operation.
+type OperationStrategy struct {
+	Operation string  `json:"operation"`
+	Type      string  `json:"type"`
+	Param     float64 `json:"param"`
+}
+
+// samplingStrategies is the strategies file of the Jaeger collector.
+type samplingStrategies struct {
+	ServiceStrategies []struct {
+		Service string `json:"service"`
+		SamplingStrategy
+	} `json:"service_strategies"`
+	DefaultStrategy *SamplingStrategy `json:"default_strategy"`
+}
+
+// defaultSamplingRefreshInterval is the refresh interval of TracingOptions.SamplingSource.
+const defaultSamplingRefreshInterval = time.Minute
+
+// samplingClient reads the http(s) sampling sources, with a timeout so that a source that
+// does not answer cannot block the refresh.
+var samplingClient = &http.Client{Timeout: 5 * time.Second}
+
+var samplingLogger = logging.NewLogger("tracing/sampling")
+
+// samplingDecider decides if a trace is sampled.
+type samplingDecider interface {
+	isSampled(id TraceID) bool
+}
+
+type constDecider bool
+
+func (d constDecider) isSampled(TraceID) bool {
+	return bool(d)
+}
+
+// maxRandomNumber masks the random bits of the low trace ID, as in the Jaeger client, so
+// that every backend takes the same decision for a trace.
+const maxRandomNumber = ^(uint64(1) << 63)
+
+// probabilisticDecider samples the traces whose random bits are below its boundary.
+type probabilisticDecider uint64
+
+func newProbabilisticDecider(samplingRate float64) probabilisticDecider {
+	return probabilisticDecider(float64(maxRandomNumber) * samplingRate)
+}
+
+func (d probabilisticDecider) isSampled(id TraceID) bool {
+	return uint64(d) >= id.Low&maxRandomNumber
+}
+
+// rateLimitingDecider samples up to its rate of traces per second.
+type rateLimitingDecider struct {
+	limiter utils.RateLimiter
+}
+
+func newRateLimitingDecider(maxTracesPerSecond float64) *rateLimitingDecider {
+	maxBalance := maxTracesPerSecond
+	if maxBalance < 1 {
+		maxBalance = 1
+	}
+	return &rateLimitingDecider{limiter: utils.NewRateLimiter(maxTracesPerSecond, maxBalance)}
+}
+
+func (d *rateLimitingDecider) isSampled(TraceID) bool {
+	return d.limiter.CheckCredit(1)
+}
+
+func newSamplingDecider(samplerType string, param float64) (samplingDecider, error) {
+	switch strings.ToLower(samplerType) {
+	case "":
+		return constDecider(true), nil
+	case SamplerConst:
+		return constDecider(param >= 1), nil
+	case SamplerProbabilistic:
+		if param < 0 || param > 1 {
+			return nil, fmt.Errorf("invalid probabilistic sampler param %g, expecting a value between 0 and 1", param)
+		}
+		return newProbabilisticDecider(param), nil
+	case SamplerRateLimiting:
+		if param < 0 {
+			return nil, fmt.Errorf("invalid ratelimiting sampler param %g, expecting a positive value", param)
+		}
+		if param == 0 {
+			// the rate limiter has a balance of at least one trace
+			return constDecider(false), nil
+		}
+		return newRateLimitingDecider(param), nil
+	}
+	return nil, fmt.Errorf("unknown sampler type %q", samplerType)
+}
+
+// strategyDeciders are the deciders of a strategy.
+type strategyDeciders struct {
+	strategy   SamplingStrategy
+	root       samplingDecider
+	operations map[string]samplingDecider
+}
+
+func newStrategyDeciders(strategy SamplingStrategy) (*strategyDeciders, error) {
+	root, err := newSamplingDecider(strategy.Type, strategy.Param)
+	if err != nil {
+		return nil, err
+	}
+	d := &strategyDeciders{
+		strategy:   strategy,
+		root:       root,
+		operations: make(map[string]samplingDecider, len(strategy.Operations)),
+	}
+	for _, op := range strategy.Operations {
+		if d.operations[op.Operation], err = newSamplingDecider(op.Type, op.Param); err != nil {
+			return nil, fmt.Errorf("operation %q: %w", op.Operation, err)
+		}
+	}
+	return d, nil
+}
+
+// sampler samples the traces with a strategy, which can be replaced at runtime. It is
+// adapted to the sampler of every tracer backend, and consulted for root spans only.
+type sampler struct {
+	service  string
+	source   string
+	deciders atomic.Value // *strategyDeciders
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// newSampler returns the sampler of the options. The strategy of ops.SamplingSource, if
+// any, replaces the strategy of the options, unless it cannot be loaded.
+func newSampler(serviceName string, ops TracingOptions) (*sampler, error) {
+	s := &sampler{
+		service: serviceName,
+		stopCh:  make(chan struct{}),
+	}
+	strategy := SamplingStrategy{
+		Type:       ops.SamplerType,
+		Param:      ops.SamplerParam,
+		Operations: ops.OperationSampling,
+	}
+	if ops.SampleAllSpans {
+		strategy = SamplingStrategy{Type: SamplerConst, Param: 1}
+	} else {
+		s.source = ops.SamplingSource
+	}
+	if err := s.update(strategy); err != nil {
+		return nil, err
+	}
+	if s.source != "" {
+		if err := s.reload(); err != nil {
+			samplingLogger.Error(fmt.Errorf("unable to load sampling strategy: %w", err))
+		}
+	}
+	return s, nil
+}
+
+func (s *sampler) isSampled(id TraceID, operation string) bool {
+	d := s.deciders.Load().(*strategyDeciders)
+	if op, ok := d.operations[operation]; ok {
+		return op.isSampled(id)
+	}
+	return d.root.isSampled(id)
+}
+
+func (s *sampler) strategy() SamplingStrategy {
+	return s.deciders.Load().(*strategyDeciders).strategy
+}
+
+func (s *sampler) update(strategy SamplingStrategy) error {
+	d, err := newStrategyDeciders(strategy)
+	if err != nil {
+		return err
+	}
+	s.deciders.Store(d)
+	return nil
+}
+
+// reload replaces the strategy by the strategy of the service in the source.
+func (s *sampler) reload() error {
+	if s.source == "" {
+		return fmt.Errorf("no sampling source")
+	}
+	data, err := readSamplingSource(s.source)
+	if err != nil {
+		return err
+	}
+	var strategies samplingStrategies
+	if err := json.Unmarshal(data, &strategies); err != nil {
+		return fmt.Errorf("invalid sampling strategies of %s: %w", s.source, err)
+	}
+	for _, ss := range strategies.ServiceStrategies {
+		if ss.Service == s.service {
+			return s.update(ss.SamplingStrategy)
+		}
+	}
+	if strategies.DefaultStrategy == nil {
+		return fmt.Errorf("no sampling strategy for service %q in %s", s.service, s.source)
+	}
+	return s.update(*strategies.DefaultStrategy)
+}
+
+func readSamplingSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	resp, err := samplingClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, source)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// startRefresh reloads the strategy every interval until close.
+func (s *sampler) startRefresh(interval time.Duration) {
+	if s.source == "" {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultSamplingRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.reload(); err != nil {
+					samplingLogger.Error(fmt.Errorf("unable to reload sampling strategy: %w", err))
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (s *sampler) close() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
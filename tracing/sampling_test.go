@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	zipkin "github.com/openzipkin/zipkin-go-opentracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingDeciders(t *testing.T) {
+	decider, err := newSamplingDecider(SamplerProbabilistic, 0.5)
+	require.NoError(t, err)
+	assert.True(t, decider.isSampled(TraceID{Low: 1}))
+	assert.True(t, decider.isSampled(TraceID{High: 1, Low: 1<<63 | 1<<61}), "the high bit is not random")
+	assert.False(t, decider.isSampled(TraceID{Low: 1<<62 | 1<<61}))
+
+	decider, err = newSamplingDecider(SamplerRateLimiting, 2)
+	require.NoError(t, err)
+	var sampled []bool
+	for i := 0; i < 3; i++ {
+		sampled = append(sampled, decider.isSampled(TraceID{Low: 1}))
+	}
+	assert.Equal(t, []bool{true, true, false}, sampled)
+
+	decider, err = newSamplingDecider(SamplerRateLimiting, 0)
+	require.NoError(t, err)
+	assert.False(t, decider.isSampled(TraceID{Low: 1}), "no trace per second")
+
+	for samplerType, want := range map[string]bool{"": true, SamplerConst: false, "CONST": false} {
+		decider, err = newSamplingDecider(samplerType, 0)
+		require.NoError(t, err)
+		assert.Equal(t, want, decider.isSampled(TraceID{Low: 1}), samplerType)
+	}
+
+	_, err = newSamplingDecider(SamplerProbabilistic, 2)
+	assert.EqualError(t, err, "invalid probabilistic sampler param 2, expecting a value between 0 and 1")
+	_, err = newSamplingDecider(SamplerRateLimiting, -1)
+	assert.EqualError(t, err, "invalid ratelimiting sampler param -1, expecting a positive value")
+	_, err = newStrategyDeciders(SamplingStrategy{Operations: []OperationStrategy{{Operation: "op", Type: "remote"}}})
+	assert.EqualError(t, err, `operation "op": unknown sampler type "remote"`)
+}
+
+// isSampled returns the sampling decision of a span of any tracer backend.
+func isSampled(span *Span) bool {
+	switch sc := span.Span.Context().(type) {
+	case interface{ IsSampled() bool }:
+		return sc.IsSampled()
+	case zipkin.SpanContext:
+		return sc.Sampled
+	}
+	return false
+}
+
+func TestOperationSampling(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, init func(ops TracingOptions) error) {
+		require.NoError(t, init(TracingOptions{
+			SamplerType:  SamplerConst,
+			SamplerParam: 1,
+			OperationSampling: []OperationStrategy{
+				{Operation: "GET /health", Type: SamplerConst, Param: 0},
+			},
+		}))
+		defer CloseTracing(context.Background())
+
+		ctx, health := StartSpan(context.Background(), "GET /health")
+		defer health.Finish()
+		_, child := StartSpan(ctx, "operation")
+		defer child.Finish()
+		_, root := StartSpan(context.Background(), "operation")
+		defer root.Finish()
+
+		if GetTracer().Collector != nil {
+			assert.True(t, isSampled(health), "zipkin ignores operation strategies")
+			return
+		}
+		assert.False(t, isSampled(health))
+		assert.False(t, isSampled(child), "the child follows its parent")
+		assert.True(t, isSampled(root))
+
+		require.NoError(t, GetTracer().SetSamplingStrategy(SamplingStrategy{Type: SamplerConst, Param: 1}))
+		_, health = StartSpan(context.Background(), "GET /health")
+		defer health.Finish()
+		assert.True(t, isSampled(health))
+		assert.Error(t, GetTracer().SetSamplingStrategy(SamplingStrategy{Type: "remote"}))
+		assert.Equal(t, SamplingStrategy{Type: SamplerConst, Param: 1}, GetTracer().SamplingStrategy())
+	})
+}
+
+const testStrategies = `{
+  "service_strategies": [
+    {"service": "backend", "type": "const", "param": 0}
+  ],
+  "default_strategy": {
+    "type": "probabilistic",
+    "param": 1,
+    "operation_strategies": [{"operation": "GET /health", "type": "const", "param": 0}]
+  }
+}`
+
+func TestSamplingSourceFile(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "strategies.json")
+	require.NoError(t, os.WriteFile(source, []byte(testStrategies), 0o600))
+
+	forEachBackend(t, func(t *testing.T, init func(ops TracingOptions) error) {
+		require.NoError(t, init(TracingOptions{SamplingSource: source}))
+		defer CloseTracing(context.Background())
+		assert.Equal(t, SamplingStrategy{Type: SamplerConst, Param: 0}, GetTracer().SamplingStrategy())
+		_, span := StartSpan(context.Background(), "operation")
+		assert.False(t, isSampled(span))
+		span.Finish()
+	})
+
+	require.NoError(t, InitTracing("other", TracingOptions{SamplingSource: source, ReportHostPort: "localhost:9412"}))
+	defer CloseTracing(context.Background())
+	assert.Equal(t, SamplingStrategy{
+		Type:       SamplerProbabilistic,
+		Param:      1,
+		Operations: []OperationStrategy{{Operation: "GET /health", Type: SamplerConst, Param: 0}},
+	}, GetTracer().SamplingStrategy(), "default strategy")
+
+	require.NoError(t, os.WriteFile(source, []byte(`{"service_strategies": [{"service": "other", "type": "const", "param": 1}]}`), 0o600))
+	require.NoError(t, GetTracer().ReloadSampling())
+	assert.Equal(t, SamplingStrategy{Type: SamplerConst, Param: 1}, GetTracer().SamplingStrategy())
+
+	require.NoError(t, os.WriteFile(source, []byte(`{"service_strategies": []}`), 0o600))
+	assert.EqualError(t, GetTracer().ReloadSampling(), `no sampling strategy for service "other" in `+source)
+	require.NoError(t, os.WriteFile(source, []byte(`{"default_strategy": {"type": "remote"}}`), 0o600))
+	assert.EqualError(t, GetTracer().ReloadSampling(), `unknown sampler type "remote"`)
+	require.NoError(t, os.WriteFile(source, []byte(`[]`), 0o600))
+	assert.Error(t, GetTracer().ReloadSampling())
+	assert.Equal(t, SamplingStrategy{Type: SamplerConst, Param: 1}, GetTracer().SamplingStrategy(), "failed reloads keep the strategy")
+}
+
+func TestSamplingSourceHTTP(t *testing.T) {
+	var param atomic.Value
+	param.Store("0")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"default_strategy": {"type": "probabilistic", "param": ` + param.Load().(string) + `}}`))
+	}))
+	defer server.Close()
+
+	require.NoError(t, InitTracing("service", TracingOptions{
+		ReportHostPort:          "localhost:9412",
+		SamplingSource:          server.URL,
+		SamplingRefreshInterval: 10 * time.Millisecond,
+	}))
+	defer CloseTracing(context.Background())
+	assert.Equal(t, SamplingStrategy{Type: SamplerProbabilistic, Param: 0}, GetTracer().SamplingStrategy())
+
+	param.Store("0.5")
+	assert.Eventually(t, func() bool {
+		return GetTracer().SamplingStrategy().Param == 0.5
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSamplingSourceErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// the strategy of the options is kept when the source cannot be loaded
+	require.NoError(t, InitTracing("service", TracingOptions{
+		ReportHostPort: "localhost:9412",
+		SamplerType:    SamplerConst,
+		SamplingSource: server.URL,
+	}))
+	assert.Equal(t, SamplingStrategy{Type: SamplerConst}, GetTracer().SamplingStrategy())
+	assert.EqualError(t, GetTracer().ReloadSampling(), "unexpected status 404 Not Found from "+server.URL)
+	CloseTracing(context.Background())
+
+	unblock := make(chan struct{})
+	blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer blocking.Close()
+	defer close(unblock)
+	defer func(client *http.Client) { samplingClient = client }(samplingClient)
+	samplingClient = &http.Client{Timeout: 50 * time.Millisecond}
+	require.NoError(t, InitTracing("service", TracingOptions{
+		ReportHostPort: "localhost:9412",
+		SamplingSource: blocking.URL,
+	}))
+	assert.Error(t, GetTracer().ReloadSampling(), "the source does not answer")
+	CloseTracing(context.Background())
+
+	require.NoError(t, InitTracing("service", TracingOptions{ReportHostPort: "localhost:9412"}))
+	assert.EqualError(t, GetTracer().ReloadSampling(), "no sampling source")
+	CloseTracing(context.Background())
+
+	InitTracingForTest()
+	assert.Equal(t, SamplingStrategy{Type: SamplerConst, Param: 1}, GetTracer().SamplingStrategy())
+	assert.EqualError(t, GetTracer().ReloadSampling(), "tracer test does not support sampling strategies")
+}
@@ -2,8 +2,12 @@ package tracing
 
 import (
 	"context"
+	"sync/atomic"
 
 	"github.com/opentracing/opentracing-go"
+	zipkin "github.com/openzipkin/zipkin-go-opentracing"
+	jaeger "github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Span Struct
@@ -13,8 +17,55 @@ type Span struct {
 	context.Context
 }
 
+// TraceIDFromContext returns the hex encoded trace ID of the span carried by ctx.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", false
+	}
+	id := traceID(span.Context())
+	return id, id != ""
+}
+
+// TraceID returns the hex encoded trace ID of the span, or "" if the tracer does not expose one.
+func (s *Span) TraceID() string {
+	return traceID(s.Span.Context())
+}
+
+func traceID(sc opentracing.SpanContext) string {
+	switch c := sc.(type) {
+	case zipkin.SpanContext:
+		if c.TraceID.Empty() {
+			return ""
+		}
+		return c.TraceID.ToHex()
+	case jaeger.SpanContext:
+		if !c.TraceID().IsValid() {
+			return ""
+		}
+		// jaeger.TraceID.String does not pad the IDs
+		return TraceID{High: c.TraceID().High, Low: c.TraceID().Low}.String()
+	case interface{ TraceID() trace.TraceID }:
+		// span context of the OpenTelemetry bridge
+		if !c.TraceID().IsValid() {
+			return ""
+		}
+		return c.TraceID().String()
+	case nil:
+		return ""
+	}
+	// other tracers, e.g. the mock tracer of InitTracingForTest, through their native propagator
+	if spanContext, err := GetTracer().spanContextOf(sc); err == nil && spanContext.TraceID.IsValid() {
+		return spanContext.TraceID.String()
+	}
+	return ""
+}
+
 func (s *Span) StoreSpanToCache(key string) *Span {
-	tracerFactory.cache.putSpan(key, s)
+	GetTracer().cache.putSpan(key, s)
 	return s
 }
 
@@ -44,9 +95,11 @@ func (s *Span) LogKV(key, value string) *Span {
 	return s
 }
 
+// Finish finishes the span, or drops it if the tracer backend is closed.
 func (s *Span) Finish() {
-	if tracerFactory.isClose {
-		panic("tracer is closed")
+	if f := GetTracer(); f.IsClosed() {
+		atomic.AddInt64(&f.stats.dropped, 1)
+		return
 	}
 	s.Span.Finish()
 }
@@ -169,7 +222,13 @@ func (s *Span) SetTag(key string, value interface{}) *Span {
 	return s
 }
 
-func (s *Span) ToBinary() (out []byte) {
-	tracerFactory.Inject(s.Span.Context(), opentracing.Binary, out)
-	return
+// ToBinary returns the binary encoding of the span context and baggage of the span, see
+// SpanContext.MarshalBinary, or nil if the tracer does not expose its span context.
+func (s *Span) ToBinary() []byte {
+	sc, err := GetTracer().spanContextOf(s.Span.Context())
+	if err != nil {
+		return nil
+	}
+	out, _ := sc.MarshalBinary()
+	return out
 }
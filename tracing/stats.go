@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	jaegermetrics "github.com/uber/jaeger-lib/metrics"
+)
+
+// Stats counts the spans of the tracer backend since InitTracing.
+type Stats struct {
+	// Sent spans were exported to the backend.
+	Sent int64
+	// Failed spans were not exported because of an error. The Zipkin collector retries
+	// the spans of network errors, so they may be counted again.
+	Failed int64
+	// Dropped spans were discarded before export, because the buffer of the reporter was
+	// full or because they finished after CloseTracing.
+	Dropped int64
+}
+
+// spanStats are the counters of Stats, updated by the hooks of the tracer backends.
+type spanStats struct {
+	sent    int64
+	failed  int64
+	dropped int64
+}
+
+func (s *spanStats) snapshot() Stats {
+	return Stats{
+		Sent:    atomic.LoadInt64(&s.sent),
+		Failed:  atomic.LoadInt64(&s.failed),
+		Dropped: atomic.LoadInt64(&s.dropped),
+	}
+}
+
+// jaegerStats counts the spans of the reporter of the Jaeger tracer, see the reporter_spans
+// counters of jaeger.Metrics. Other metrics of the tracer are discarded.
+type jaegerStats struct {
+	stats *spanStats
+}
+
+func (f jaegerStats) Counter(name string, tags map[string]string) jaegermetrics.Counter {
+	if name != "reporter_spans" {
+		return jaegermetrics.NullCounter
+	}
+	switch tags["result"] {
+	case "ok":
+		return statsCounter{&f.stats.sent}
+	case "err":
+		return statsCounter{&f.stats.failed}
+	case "dropped":
+		return statsCounter{&f.stats.dropped}
+	}
+	return jaegermetrics.NullCounter
+}
+
+func (f jaegerStats) Timer(name string, tags map[string]string) jaegermetrics.Timer {
+	return jaegermetrics.NullTimer
+}
+
+func (f jaegerStats) Gauge(name string, tags map[string]string) jaegermetrics.Gauge {
+	return jaegermetrics.NullGauge
+}
+
+func (f jaegerStats) Namespace(name string, tags map[string]string) jaegermetrics.Factory {
+	return f
+}
+
+type statsCounter struct {
+	value *int64
+}
+
+func (c statsCounter) Inc(delta int64) {
+	atomic.AddInt64(c.value, delta)
+}
+
+// zipkinStats counts the spans of the requests of the Zipkin HTTP collector, and the
+// spans it disposes of when its backlog is too long.
+type zipkinStats struct {
+	stats     *spanStats
+	transport http.RoundTripper
+}
+
+func (z zipkinStats) RoundTrip(req *http.Request) (*http.Response, error) {
+	spans := zipkinRequestSpans(req)
+	resp, err := z.transport.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		atomic.AddInt64(&z.stats.failed, spans)
+	} else {
+		atomic.AddInt64(&z.stats.sent, spans)
+	}
+	return resp, err
+}
+
+// zipkinRequestSpans returns the number of spans of a request of the Zipkin HTTP collector,
+// whose body is a thrift list of spans: the type of the elements and their int32 count.
+func zipkinRequestSpans(req *http.Request) int64 {
+	if req.GetBody == nil {
+		return 0
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return 0
+	}
+	defer body.Close()
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint32(header[1:]))
+}
+
+// Log counts the spans of the "backlog too long, disposing spans." message.
+func (z zipkinStats) Log(keyvals ...interface{}) error {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "count" {
+			if count, ok := keyvals[i+1].(int); ok {
+				atomic.AddInt64(&z.stats.dropped, int64(count))
+			}
+		}
+	}
+	return nil
+}
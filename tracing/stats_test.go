@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, init func(ops TracingOptions) error) {
+		require.NoError(t, init(TracingOptions{}))
+		for i := 0; i < 3; i++ {
+			_, span := StartSpan(context.Background(), "operation")
+			span.Finish()
+		}
+		_, late := StartSpan(context.Background(), "late")
+		require.NoError(t, CloseTracing(context.Background()))
+		assert.Equal(t, Stats{Sent: 3}, GetTracer().Stats())
+
+		assert.NotPanics(t, late.Finish)
+		assert.Equal(t, Stats{Sent: 3, Dropped: 1}, GetTracer().Stats())
+		assert.NoError(t, CloseTracing(context.Background()), "closing twice")
+	})
+}
+
+func TestZipkinStatsFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	require.NoError(t, InitTracing("service", TracingOptions{ReportHostPort: strings.TrimPrefix(server.URL, "http://")}))
+	for i := 0; i < 2; i++ {
+		_, span := StartSpan(context.Background(), "operation")
+		span.Finish()
+	}
+	require.NoError(t, CloseTracing(context.Background()))
+	assert.Equal(t, Stats{Failed: 2}, GetTracer().Stats())
+}
+
+func TestCloseTracingDeadline(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	require.NoError(t, InitTracing("service", TracingOptions{ReportHostPort: strings.TrimPrefix(server.URL, "http://")}))
+	_, span := StartSpan(context.Background(), "operation")
+	span.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := CloseTracing(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, GetTracer().IsClosed())
+	assert.NotPanics(t, func() {
+		_, span := StartSpan(context.Background(), "operation")
+		span.Finish()
+	})
+	assert.EqualValues(t, 1, GetTracer().Stats().Dropped)
+}
+
+func TestZipkinFinishAfterClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	require.NoError(t, InitTracing("service", TracingOptions{ReportHostPort: strings.TrimPrefix(server.URL, "http://")}))
+	_, span := StartSpan(context.Background(), "operation")
+	require.NoError(t, CloseTracing(context.Background()))
+
+	// a Finish that checked IsClosed before CloseTracing reaches the collector afterwards
+	done := make(chan struct{})
+	go func() {
+		span.Span.Finish()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the span is collected after the collector is closed")
+	}
+	assert.Equal(t, Stats{Dropped: 1}, GetTracer().Stats())
+	assert.NoError(t, GetTracer().Collector.Close(), "closing twice")
+}
+
+func TestInitTracingClosesPrevious(t *testing.T) {
+	require.NoError(t, InitTracing("service", TracingOptions{ReportHostPort: "localhost:9412"}))
+	previous := GetTracer()
+	InitTracingForTest()
+	assert.True(t, previous.IsClosed())
+
+	previous = GetTracer()
+	require.NoError(t, InitTracing("service", TracingOptions{Tracer: TracerJaeger, ReportHostPort: "localhost:6831"}))
+	defer CloseTracing(context.Background())
+	assert.True(t, previous.IsClosed())
+	assert.False(t, GetTracer().IsClosed())
+}
@@ -17,10 +17,10 @@ func TestMain(m *testing.M) {
 
 func func2(ctx context.Context, cnt int) {
 
-	span := NewSpanFromContext(fmt.Sprintf("func2-%d", cnt), ctx)
+	_, span := StartSpan(ctx, fmt.Sprintf("func2-%d", cnt))
 	defer span.Finish()
 	span.SetSamplingPriority(1)
-	time.Sleep(1 * time.Second)
+	time.Sleep(10 * time.Millisecond)
 	span.SetDBType("dasdsa")
 	span.Log("done")
 	span.LogKV("baggage", span.GetBaggage("userId"))
@@ -35,9 +35,9 @@ func TestNewSpanFactory(t *testing.T) {
 		ReportHostPort: "localhost:9412",
 	})
 	require.NoError(err)
-	defer CloseTracing()
+	defer CloseTracing(context.Background())
 
-	span := NewRootSpan("span1")
+	ctx, span := StartSpan(context.Background(), "span1")
 	span.SetSpanKindRPCServer()
 	span.SetSamplingPriority(1)
 	span.LogKV("asd", "asdasd")
@@ -45,10 +45,10 @@ func TestNewSpanFactory(t *testing.T) {
 	span.SetTag("userId", 1111)
 	span.SetBaggage("userId", "1111")
 	for i := 0; i < 10; i++ {
-		go func2(span.GetContextFromSpan(), i)
+		go func2(ctx, i)
 	}
 
-	time.Sleep(10 * time.Second)
+	time.Sleep(100 * time.Millisecond)
 	span.LogKV("baggage", span.GetBaggage("userId"))
 	span.Log("done")
 	span.Finish()
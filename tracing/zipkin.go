@@ -2,18 +2,38 @@ package tracing
 
 import (
 	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 	zipkin "github.com/openzipkin/zipkin-go-opentracing"
+	"github.com/openzipkin/zipkin-go-opentracing/thrift/gen-go/zipkincore"
 )
 
 func InitZipkin(ops TracingOptions, serviceName string) (opentracing.Tracer, zipkin.Collector, error) {
+	s, err := newSampler(serviceName, ops)
+	if err != nil {
+		return nil, nil, err
+	}
+	return initZipkin(ops, serviceName, s, &spanStats{})
+}
+
+// initZipkin returns a Zipkin tracer, whose sampler only sees the trace ID, so the operation
+// strategies of s do not apply. The spans of the collector are counted in stats.
+func initZipkin(ops TracingOptions, serviceName string, s *sampler, stats *spanStats) (opentracing.Tracer, zipkin.Collector, error) {
 	zipkinHTTPEndpoint := fmt.Sprintf("http://%s/api/v1/spans", ops.ReportHostPort)
-	collector, err := zipkin.NewHTTPCollector(zipkinHTTPEndpoint)
+	counter := zipkinStats{stats: stats, transport: http.DefaultTransport}
+	httpCollector, err := zipkin.NewHTTPCollector(zipkinHTTPEndpoint,
+		zipkin.HTTPClient(&http.Client{Timeout: 5 * time.Second, Transport: counter}),
+		zipkin.HTTPLogger(counter),
+	)
 	if err != nil {
 		fmt.Printf("unable to create Zipkin HTTP collector: %+v\n", err)
 		return nil, nil, err
 	}
+	collector := &zipkinCollector{collector: httpCollector, stats: stats}
 
 	// create recorder.
 	recorder := zipkin.NewRecorder(collector, ops.Debug, ops.LocalHostPort, serviceName)
@@ -23,6 +43,9 @@ func InitZipkin(ops TracingOptions, serviceName string) (opentracing.Tracer, zip
 		recorder,
 		zipkin.ClientServerSameSpan(true),
 		zipkin.TraceID128Bit(true),
+		zipkin.WithSampler(func(id uint64) bool {
+			return s.isSampled(TraceID{Low: id}, "")
+		}),
 	)
 	if err != nil {
 		fmt.Printf("unable to create Zipkin tracer: %+v\n", err)
@@ -35,3 +58,34 @@ func InitZipkin(ops TracingOptions, serviceName string) (opentracing.Tracer, zip
 	return t, collector, nil
 
 }
+
+// zipkinCollector drops the spans collected after Close, which the HTTP collector would
+// wait for forever once its loop has returned.
+type zipkinCollector struct {
+	collector zipkin.Collector
+	stats     *spanStats
+	mu        sync.RWMutex
+	closed    bool
+}
+
+func (c *zipkinCollector) Collect(span *zipkincore.Span) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		atomic.AddInt64(&c.stats.dropped, 1)
+		return nil
+	}
+	return c.collector.Collect(span)
+}
+
+// Close waits for the spans being collected, then flushes and closes the HTTP collector.
+func (c *zipkinCollector) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	return c.collector.Close()
+}
@@ -0,0 +1,72 @@
+package webservice
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/liornabat/golibs/instrument"
+)
+
+// requestMetrics records the RED metrics (rate, errors and duration) of the server routes,
+// labeled by method, route template and status class.
+type requestMetrics struct {
+	requests *instrument.InstrumentArray
+	errors   *instrument.InstrumentArray
+	sizes    *instrument.InstrumentArray
+}
+
+func newRequestMetrics(registry *instrument.Registry, nameSpace, subSystem string) *requestMetrics {
+	if registry == nil {
+		registry = instrument.DefaultRegistry
+	}
+	m := &requestMetrics{
+		requests: registry.NewInstrumentArray(nameSpace, subSystem, "http_requests").
+			AddCounter([]string{"method", "route", "status"}, "number of http requests").
+			AddGauge([]string{"method", "route"}, "number of http requests in flight").
+			AddHistogram([]string{"method", "route", "status"}, prometheus.DefBuckets, "latency of http requests in seconds"),
+		errors: registry.NewInstrumentArray(nameSpace, subSystem, "http_errors").
+			AddCounter([]string{"method", "route", "status"}, "number of http requests that failed with a 5xx status or a gin error"),
+		sizes: registry.NewInstrumentArray(nameSpace, subSystem, "http_response_bytes").
+			AddHistogram([]string{"method", "route", "status"}, prometheus.ExponentialBuckets(100, 10, 6), "size of http responses in bytes"),
+	}
+	for _, ia := range []*instrument.InstrumentArray{m.requests, m.errors, m.sizes} {
+		if err := ia.Err(); err != nil {
+			logger.Error(err, "request metrics are partially disabled")
+		}
+	}
+	return m
+}
+
+// handler returns the middleware of a route, route is the template the route was added
+// with, e.g. "/users/:id", so that metrics do not grow with every raw path.
+func (m *requestMetrics) handler(method, route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.requests.IncToGauge(method, route)
+		defer m.requests.DecFromGauge(method, route)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		class := statusClass(status)
+		m.requests.IncToCounter(method, route, class).
+			ObserveHistogram(time.Since(start).Seconds(), method, route, class)
+		if status >= 500 || len(c.Errors) > 0 {
+			m.errors.IncToCounter(method, route, class)
+		}
+		if size := c.Writer.Size(); size >= 0 {
+			m.sizes.ObserveHistogram(float64(size), method, route, class)
+		}
+	}
+}
+
+// statusClass returns the class of the status code, e.g. "2xx".
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,90 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	promModel "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liornabat/golibs/instrument"
+)
+
+func findSeries(t *testing.T, families []*promModel.MetricFamily, name string, labels map[string]string) *promModel.Metric {
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			actual := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				actual[l.GetName()] = l.GetValue()
+			}
+			if assert.ObjectsAreEqual(labels, actual) {
+				return m
+			}
+		}
+	}
+	require.FailNow(t, "series not found", "%s %v", name, labels)
+	return nil
+}
+
+func TestRequestMetrics(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	registry := prometheus.NewPedanticRegistry()
+	s := NewServer("0").SetRequestMetrics(instrument.NewRegistry(registry), "svc", "").
+		AddRoute(GET, "/users/:id", func(c *gin.Context) {
+			c.String(http.StatusOK, "user "+c.Param("id"))
+		}).
+		AddRoute(POST, "/users", func(c *gin.Context) {
+			c.String(http.StatusInternalServerError, "failed")
+		})
+
+	router := gin.New()
+	for _, r := range s.routes {
+		switch r.kind {
+		case GET:
+			router.GET(r.path, s.routeHandlers(http.MethodGet, r)...)
+		case POST:
+			router.POST(r.path, s.routeHandlers(http.MethodPost, r)...)
+		}
+	}
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/users/2", nil),
+		httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("{}")),
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	get := map[string]string{"method": "GET", "route": "/users/:id", "status": "2xx"}
+	post := map[string]string{"method": "POST", "route": "/users", "status": "5xx"}
+	assert.EqualValues(t, 2, findSeries(t, families, "svc_http_requests_totals", get).GetCounter().GetValue())
+	assert.EqualValues(t, 1, findSeries(t, families, "svc_http_requests_totals", post).GetCounter().GetValue())
+	assert.EqualValues(t, 2, findSeries(t, families, "svc_http_requests_Observations", get).GetHistogram().GetSampleCount())
+	assert.EqualValues(t, 1, findSeries(t, families, "svc_http_errors_totals", post).GetCounter().GetValue())
+	assert.EqualValues(t, 0, findSeries(t, families, "svc_http_requests_metrics",
+		map[string]string{"method": "GET", "route": "/users/:id"}).GetGauge().GetValue())
+	size := findSeries(t, families, "svc_http_response_bytes_Observations", get).GetHistogram()
+	assert.EqualValues(t, 2, size.GetSampleCount())
+	assert.EqualValues(t, len("user 1")+len("user 2"), size.GetSampleSum())
+	for _, f := range families {
+		if f.GetName() == "svc_http_errors_totals" {
+			assert.Len(t, f.GetMetric(), 1, "only the failed route counts errors")
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", statusClass(http.StatusOK))
+	assert.Equal(t, "4xx", statusClass(http.StatusNotFound))
+	assert.Equal(t, "5xx", statusClass(http.StatusBadGateway))
+	assert.Equal(t, "unknown", statusClass(0))
+}
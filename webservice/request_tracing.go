@@ -0,0 +1,32 @@
+package webservice
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/liornabat/golibs/tracing"
+)
+
+// tracingHandler returns the middleware starting a server span of every request of the route,
+// child of the span context in the request headers. Handlers get the span from
+// c.Request.Context(), e.g. to pass it to RestClient.NewRequest.
+func tracingHandler(method, route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := tracing.StartServerSpan(c.Request.Context(), method+" "+route, c.Request.Header)
+		defer span.Finish()
+		span.SetComponent("webservice").
+			SetHTTPMethod(method).
+			SetHTTPUrl(c.Request.URL.String())
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetHTTPStatusCode(uint16(status))
+		if len(c.Errors) > 0 {
+			span.LogKV("error-message", c.Errors.String())
+		}
+		if status >= 500 || len(c.Errors) > 0 {
+			span.SetErrorTag()
+		}
+	}
+}
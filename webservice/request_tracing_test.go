@@ -0,0 +1,100 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/liornabat/golibs/tracing"
+)
+
+func TestRequestTracing(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	recorder := tracing.InitTracingForTest()
+	s := NewServer("0").SetTracing(true).
+		AddRoute(GET, "/users/:id", func(c *gin.Context) {
+			_, span := tracing.StartSpan(c.Request.Context(), "load user")
+			span.Finish()
+			c.String(http.StatusOK, "user "+c.Param("id"))
+		}).
+		AddRoute(POST, "/users", func(c *gin.Context) {
+			c.String(http.StatusInternalServerError, "failed")
+		})
+
+	router := gin.New()
+	for _, r := range s.routes {
+		switch r.kind {
+		case GET:
+			router.GET(r.path, s.routeHandlers(http.MethodGet, r)...)
+		case POST:
+			router.POST(r.path, s.routeHandlers(http.MethodPost, r)...)
+		}
+	}
+
+	_, client := tracing.StartSpan(context.Background(), "client")
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	require.NoError(t, tracing.Inject(client, req.Header))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("{}")))
+	client.Finish()
+
+	get := recorder.FindByName("GET /users/:id")
+	require.Len(t, get, 1)
+	assert.Equal(t, recorder.FindByName("client")[0], recorder.Parent(get[0]))
+	assert.EqualValues(t, "server", get[0].Tag("span.kind"))
+	assert.Equal(t, "/users/1", get[0].Tag("http.url"))
+	assert.EqualValues(t, http.StatusOK, get[0].Tag("http.status_code"))
+	assert.Nil(t, get[0].Tag("error"))
+	children := recorder.Children(get[0])
+	require.Len(t, children, 1)
+	assert.Equal(t, "load user", children[0].OperationName)
+
+	post := recorder.FindByName("POST /users")
+	require.Len(t, post, 1)
+	assert.Nil(t, recorder.Parent(post[0]))
+	assert.EqualValues(t, http.StatusInternalServerError, post[0].Tag("http.status_code"))
+	assert.Equal(t, true, post[0].Tag("error"))
+}
+
+func TestRestClientInjectsHeaders(t *testing.T) {
+	recorder := tracing.InitTracingForTest()
+	headers := make(chan http.Header, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	sep := strings.LastIndex(server.URL, ":")
+	host, port := server.URL[:sep], server.URL[sep+1:]
+
+	ctx, parent := tracing.StartSpan(context.Background(), "parent")
+	_, err := NewRestClient("users", host, port, "", "").
+		AddBaseRoute("users", "/users").
+		NewRequest(ctx, "users").Get()
+	require.NoError(t, err)
+	_, err = NewRestClientWithTracer(tracing.GetTracer(), "users", host, port, "", "").
+		AddBaseRoute("users", "/users").
+		NewRequest(ctx, "users").Get()
+	require.NoError(t, err)
+	parent.Finish()
+
+	_, untraced := tracing.StartServerSpan(context.Background(), "untraced client", <-headers)
+	untraced.Finish()
+	_, traced := tracing.StartServerSpan(context.Background(), "traced client", <-headers)
+	traced.Finish()
+
+	parents := recorder.FindByName("parent")
+	require.Len(t, parents, 1)
+	assert.Equal(t, parents[0], recorder.Parent(recorder.FindByName("untraced client")[0]))
+	clients := recorder.FindByName("rest_client/execute")
+	require.Len(t, clients, 1)
+	assert.Equal(t, "client", clients[0].Tag("span.kind"))
+	assert.Equal(t, parents[0], recorder.Parent(clients[0]))
+	assert.Equal(t, clients[0], recorder.Parent(recorder.FindByName("traced client")[0]))
+}
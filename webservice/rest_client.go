@@ -99,8 +99,10 @@ func (c *RestClient) NewRequest(ctx context.Context, baseName string) *ClientReq
 
 func (c *RestClient) NewAuthenticatedRequest(ctx context.Context, baseName string, authToken string) *ClientRequest {
 	cr := &ClientRequest{
-		r:   resty.R(),
-		ins: c.ins,
+		r:      resty.R(),
+		ins:    c.ins,
+		ctx:    ctx,
+		tracer: c.tracer,
 	}
 	cr.base = baseName
 	cr.r.SetHeaders(c.Headers)
@@ -187,6 +189,9 @@ func (cr *ClientRequest) Delete() (*ClientResponse, error) {
 func (cr *ClientRequest) execute(kind, url string) (*ClientResponse, error) {
 	var response *resty.Response
 	var err error
+	if err := tracing.InjectContext(cr.ctx, cr.r.Header); err != nil {
+		loggerHttp.Error(err, "inject span context to headers")
+	}
 	loggerHttp.Debug(fmt.Sprintf("calling %s: %s ", kind, cr.path))
 	start := time.Now()
 	defer func() {
@@ -233,10 +238,14 @@ func (cr *ClientRequest) executeWithTracing(kind, url string) (*ClientResponse,
 	_, span := tracing.StartSpan(cr.ctx, "rest_client/execute")
 	defer span.Finish()
 
+	span.SetSpanKindRPCClient()
 	span.SetHTTPUrl(url)
 	span.LogKV("path", cr.path)
 	var response *resty.Response
 	var err error
+	if err := tracing.Inject(span, cr.r.Header); err != nil {
+		loggerHttp.Error(err, "inject span context to headers")
+	}
 	loggerHttp.Debug(fmt.Sprintf("calling %s: %s ", kind, cr.path))
 	start := time.Now()
 	defer func() {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/liornabat/golibs/instrument"
 	log "github.com/liornabat/golibs/logging"
 	"time"
 
@@ -26,6 +27,9 @@ type Server struct {
 	readyFunc    func() (bool, string)
 	isSocketIO   bool
 	isPrometheus bool
+	metrics      http.Handler
+	requests     *requestMetrics
+	isTracing    bool
 	routes       map[string]*route
 	isCors       bool
 	corsConfig   cors.Config
@@ -93,6 +97,29 @@ func (s *Server) SetPrometheus(set bool) *Server {
 	return s
 }
 
+// SetMetricsHandler serves /metrics with the given handler instead of promhttp.Handler(),
+// e.g. metrics.LocalBackend.PrometheusHandler().
+func (s *Server) SetMetricsHandler(h http.Handler) *Server {
+	s.isPrometheus = true
+	s.metrics = h
+	return s
+}
+
+// SetRequestMetrics records the request count, errors, requests in flight, latency and
+// response size of the routes added with AddRoute, labeled by method, route template and
+// status class. A nil registry selects instrument.DefaultRegistry.
+func (s *Server) SetRequestMetrics(registry *instrument.Registry, nameSpace, subSystem string) *Server {
+	s.requests = newRequestMetrics(registry, nameSpace, subSystem)
+	return s
+}
+
+// SetTracing starts a server span of every request of the routes added with AddRoute,
+// continuing the trace of the span context in the request headers, see tracing.Extract.
+func (s *Server) SetTracing(set bool) *Server {
+	s.isTracing = set
+	return s
+}
+
 func (s *Server) AddRoute(kind RouteType, path string, f func(c *gin.Context)) *Server {
 	s.routes[path] = &route{kind: kind, path: path, f: f}
 	return s
@@ -210,13 +237,13 @@ func (s *Server) startHttpServer() {
 	for _, value := range s.routes {
 		switch value.kind {
 		case GET:
-			router.GET(value.path, value.f)
+			router.GET(value.path, s.routeHandlers(http.MethodGet, value)...)
 		case POST:
-			router.POST(value.path, value.f)
+			router.POST(value.path, s.routeHandlers(http.MethodPost, value)...)
 		case PUT:
-			router.PUT(value.path, value.f)
+			router.PUT(value.path, s.routeHandlers(http.MethodPut, value)...)
 		case DELETE:
-			router.DELETE(value.path, value.f)
+			router.DELETE(value.path, s.routeHandlers(http.MethodDelete, value)...)
 		}
 	}
 
@@ -227,7 +254,11 @@ func (s *Server) startHttpServer() {
 	}
 
 	if s.isPrometheus {
-		router.Any("/metrics", gin.WrapH(promhttp.Handler()))
+		if s.metrics != nil {
+			router.Any("/metrics", gin.WrapH(s.metrics))
+		} else {
+			router.Any("/metrics", gin.WrapH(promhttp.Handler()))
+		}
 	}
 
 	if s.jwt != nil {
@@ -251,6 +282,17 @@ func (s *Server) startHttpServer() {
 
 }
 
+func (s *Server) routeHandlers(method string, r *route) []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+	if s.isTracing {
+		handlers = append(handlers, tracingHandler(method, r.path))
+	}
+	if s.requests != nil {
+		handlers = append(handlers, s.requests.handler(method, r.path))
+	}
+	return append(handlers, r.f)
+}
+
 func (s *Server) sendLogs(msg string) {
 	s.wsServer.BroadcastTo("main", "/logs", msg)
 }